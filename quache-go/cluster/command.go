@@ -0,0 +1,73 @@
+package cluster
+
+import (
+	"encoding/json"
+
+	"github.com/AstraBert/quache/quache-go/core"
+)
+
+// commandOp names the KVStore mutation a Command replays once it has been
+// committed by Raft.
+type commandOp string
+
+const (
+	opPut       commandOp = "put"
+	opDelete    commandOp = "delete"
+	opCAS       commandOp = "cas"
+	opCASDelete commandOp = "cas_delete"
+	opAcquire   commandOp = "acquire"
+	opRelease   commandOp = "release"
+	opTxn       commandOp = "txn"
+)
+
+// Command is the payload proposed to Raft for every write: it is marshaled
+// to JSON and appended as a single log entry, then replayed against the
+// local core.KVStore by FSM.Apply on every node once a majority has
+// persisted it.
+type Command struct {
+	Op      commandOp    `json:"op"`
+	Key     string       `json:"key,omitempty"`
+	Value   any          `json:"value,omitempty"`
+	Ttl     *float64     `json:"ttl,omitempty"`
+	CAS     uint64       `json:"cas,omitempty"`
+	Session string       `json:"session,omitempty"`
+	Ops     []core.TxnOp `json:"ops,omitempty"`
+}
+
+func newPutCommand(key string, value any, ttl *float64) Command {
+	return Command{Op: opPut, Key: key, Value: value, Ttl: ttl}
+}
+
+func newDeleteCommand(key string) Command {
+	return Command{Op: opDelete, Key: key}
+}
+
+func newCASCommand(key string, value any, ttl *float64, cas uint64) Command {
+	return Command{Op: opCAS, Key: key, Value: value, Ttl: ttl, CAS: cas}
+}
+
+func newCASDeleteCommand(key string, cas uint64) Command {
+	return Command{Op: opCASDelete, Key: key, CAS: cas}
+}
+
+func newAcquireCommand(key string, value any, ttl *float64, session string) Command {
+	return Command{Op: opAcquire, Key: key, Value: value, Ttl: ttl, Session: session}
+}
+
+func newReleaseCommand(key string, session string) Command {
+	return Command{Op: opRelease, Key: key, Session: session}
+}
+
+func newTxnCommand(ops []core.TxnOp) Command {
+	return Command{Op: opTxn, Ops: ops}
+}
+
+func (c Command) encode() ([]byte, error) {
+	return json.Marshal(c)
+}
+
+func decodeCommand(data []byte) (Command, error) {
+	var c Command
+	err := json.Unmarshal(data, &c)
+	return c, err
+}
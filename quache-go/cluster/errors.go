@@ -0,0 +1,21 @@
+package cluster
+
+import "fmt"
+
+// NotLeaderError is returned by Node.Put/Delete when the local node is not
+// the Raft leader and so cannot propose a write itself. LeaderAddr is
+// included (when known) so the caller can redirect the request.
+type NotLeaderError struct {
+	LeaderAddr string
+}
+
+func (e NotLeaderError) Error() string {
+	if e.LeaderAddr == "" {
+		return "this node is not the raft leader, and no leader is currently known"
+	}
+	return fmt.Sprintf("this node is not the raft leader; the current leader is at %s", e.LeaderAddr)
+}
+
+func NewNotLeaderError(leaderAddr string) NotLeaderError {
+	return NotLeaderError{LeaderAddr: leaderAddr}
+}
@@ -0,0 +1,122 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/AstraBert/quache/quache-go/core"
+	"github.com/hashicorp/raft"
+)
+
+// FSM replays committed Raft log entries against a local core.KVStore, so
+// every node in the cluster converges on the same state regardless of which
+// node a write was proposed to.
+type FSM struct {
+	kv *core.KVStore
+}
+
+// NewFSM wraps kv so it can be driven by Raft's replicated log.
+func NewFSM(kv *core.KVStore) *FSM {
+	return &FSM{kv: kv}
+}
+
+// txnApplyResult carries both halves of KVStore.Transaction's return value
+// through a single raft.ApplyFuture.Response(), since that value only ever
+// travels in-process (to the node that proposed the command) and so never
+// needs to be (de)serializable the way Command itself does.
+type txnApplyResult struct {
+	results []core.TxnResult
+	err     error
+}
+
+// Apply replays a single committed Command against the local KVStore. The
+// returned value is either nil/the operation's result (success) or an
+// error, which callers read back via raft.ApplyFuture.Response().
+func (f *FSM) Apply(log *raft.Log) any {
+	cmd, err := decodeCommand(log.Data)
+	if err != nil {
+		return fmt.Errorf("decoding raft log entry: %w", err)
+	}
+	switch cmd.Op {
+	case opPut:
+		idx, err := f.kv.Put(context.Background(), cmd.Key, cmd.Value, cmd.Ttl)
+		if err != nil {
+			return err
+		}
+		return idx
+	case opDelete:
+		if err := f.kv.Delete(context.Background(), cmd.Key); err != nil {
+			return err
+		}
+		return nil
+	case opCAS:
+		idx, _, err := f.kv.CompareAndSwap(cmd.Key, cmd.Value, cmd.Ttl, cmd.CAS)
+		if err != nil {
+			return err
+		}
+		return idx
+	case opCASDelete:
+		if _, err := f.kv.CompareAndDelete(cmd.Key, cmd.CAS); err != nil {
+			return err
+		}
+		return nil
+	case opAcquire:
+		idx, _, err := f.kv.Acquire(cmd.Key, cmd.Value, cmd.Ttl, cmd.Session)
+		if err != nil {
+			return err
+		}
+		return idx
+	case opRelease:
+		if _, err := f.kv.Release(cmd.Key, cmd.Session); err != nil {
+			return err
+		}
+		return nil
+	case opTxn:
+		results, txnErr := f.kv.Transaction(cmd.Ops)
+		return txnApplyResult{results: results, err: txnErr}
+	default:
+		return fmt.Errorf("unknown raft command op %q", cmd.Op)
+	}
+}
+
+// Snapshot hands back a point-in-time view that fsmSnapshot.Persist will
+// flush to the KVStore's backend, reusing the same per-shard persistence
+// quache already uses for its regular ToDisk flushes.
+func (f *FSM) Snapshot() (raft.FSMSnapshot, error) {
+	return &fsmSnapshot{kv: f.kv}, nil
+}
+
+// Restore rehydrates the local KVStore from whatever its backend currently
+// holds. This assumes the backend (e.g. a BoltBackend or FileBackend
+// directory) is reachable from every node taking part in the snapshot, the
+// same simplifying assumption quache's single-node ToDisk/
+// NewKVStoreFromDisk pair already makes about its storage directory.
+func (f *FSM) Restore(rc io.ReadCloser) error {
+	defer rc.Close()
+	if _, err := io.ReadAll(rc); err != nil {
+		return err
+	}
+	return f.kv.ReloadFromBackend()
+}
+
+// fsmSnapshot implements raft.FSMSnapshot on top of KVStore.ToDisk, so a
+// Raft snapshot is just a flush through the already-pluggable Backend
+// rather than a second, parallel serialization format.
+type fsmSnapshot struct {
+	kv *core.KVStore
+}
+
+func (s *fsmSnapshot) Persist(sink raft.SnapshotSink) error {
+	if err := s.kv.ToDisk(context.Background()); err != nil {
+		_ = sink.Cancel()
+		return err
+	}
+	if _, err := sink.Write([]byte(s.kv.Directory)); err != nil {
+		_ = sink.Cancel()
+		return err
+	}
+	return sink.Close()
+}
+
+func (s *fsmSnapshot) Release() {}
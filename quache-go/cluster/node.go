@@ -0,0 +1,306 @@
+// Package cluster wraps a core.KVStore with Raft-based replication, so a
+// set of quache nodes can agree on a single sequence of writes and keep
+// serving reads if a minority of them go down. Writes are proposed to the
+// Raft leader and only take effect once FSM.Apply replays them locally on
+// every node that has the entry committed; reads can either be routed to
+// the leader for linearizability or served from the local KVStore for
+// lower latency at the cost of possibly being stale.
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"time"
+
+	"github.com/AstraBert/quache/quache-go/core"
+	"github.com/hashicorp/raft"
+	raftboltdb "github.com/hashicorp/raft-boltdb/v2"
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultRaftTimeout bounds how long Node.Put/Delete wait for a proposed
+// command to be committed before giving up.
+const DefaultRaftTimeout time.Duration = 10 * time.Second
+
+// Config configures a single Node. BindAddr is the address Raft uses to
+// replicate log entries between nodes, distinct from the HTTP address the
+// server package listens on.
+type Config struct {
+	NodeID    string
+	BindAddr  string
+	DataDir   string
+	Bootstrap bool
+	KVStore   *core.KVStore
+}
+
+// Node is a single member of a quache cluster: a core.KVStore driven by a
+// Raft-replicated log.
+type Node struct {
+	ID     string
+	kv     *core.KVStore
+	fsm    *FSM
+	raft   *raft.Raft
+	logger *logrus.Logger
+}
+
+// NewNode starts (or rejoins) a Raft-backed node over cfg.KVStore. If
+// cfg.Bootstrap is set, the node bootstraps a brand-new single-node
+// cluster that others can later Join; otherwise it expects to be added to
+// an existing cluster via that cluster's leader.
+func NewNode(cfg Config, logger *logrus.Logger) (*Node, error) {
+	fsm := NewFSM(cfg.KVStore)
+
+	raftConfig := raft.DefaultConfig()
+	raftConfig.LocalID = raft.ServerID(cfg.NodeID)
+
+	addr, err := net.ResolveTCPAddr("tcp", cfg.BindAddr)
+	if err != nil {
+		return nil, fmt.Errorf("resolving raft bind address %q: %w", cfg.BindAddr, err)
+	}
+	transport, err := raft.NewTCPTransport(cfg.BindAddr, addr, 3, 10*time.Second, os.Stderr)
+	if err != nil {
+		return nil, fmt.Errorf("creating raft transport: %w", err)
+	}
+
+	snapshots, err := raft.NewFileSnapshotStore(cfg.DataDir, 2, os.Stderr)
+	if err != nil {
+		return nil, fmt.Errorf("creating raft snapshot store: %w", err)
+	}
+
+	logStore, err := raftboltdb.NewBoltStore(path.Join(cfg.DataDir, "raft-log.db"))
+	if err != nil {
+		return nil, fmt.Errorf("creating raft log store: %w", err)
+	}
+	stableStore, err := raftboltdb.NewBoltStore(path.Join(cfg.DataDir, "raft-stable.db"))
+	if err != nil {
+		return nil, fmt.Errorf("creating raft stable store: %w", err)
+	}
+
+	r, err := raft.NewRaft(raftConfig, fsm, logStore, stableStore, snapshots, transport)
+	if err != nil {
+		return nil, fmt.Errorf("creating raft node: %w", err)
+	}
+
+	if cfg.Bootstrap {
+		future := r.BootstrapCluster(raft.Configuration{
+			Servers: []raft.Server{
+				{ID: raftConfig.LocalID, Address: transport.LocalAddr()},
+			},
+		})
+		if err := future.Error(); err != nil {
+			return nil, fmt.Errorf("bootstrapping raft cluster: %w", err)
+		}
+	}
+
+	return &Node{ID: cfg.NodeID, kv: cfg.KVStore, fsm: fsm, raft: r, logger: logger}, nil
+}
+
+// IsLeader reports whether this node is currently the Raft leader.
+func (n *Node) IsLeader() bool {
+	return n.raft.State() == raft.Leader
+}
+
+// propose encodes cmd, proposes it to the Raft log, and waits for it to be
+// committed and applied locally, returning whatever FSM.Apply returned for
+// it. It returns NotLeaderError up front if this node is not the leader,
+// since only the leader may propose writes.
+func (n *Node) propose(cmd Command) (any, error) {
+	if !n.IsLeader() {
+		return nil, NewNotLeaderError(string(n.raft.Leader()))
+	}
+	encoded, err := cmd.encode()
+	if err != nil {
+		return nil, err
+	}
+	future := n.raft.Apply(encoded, DefaultRaftTimeout)
+	if err := future.Error(); err != nil {
+		return nil, err
+	}
+	return future.Response(), nil
+}
+
+// Put proposes a Put command to the Raft log and waits for it to be
+// committed and applied locally. It returns NotLeaderError if this node is
+// not the leader, since only the leader may propose writes.
+func (n *Node) Put(key string, value any, ttl *float64) (uint64, error) {
+	resp, err := n.propose(newPutCommand(key, value, ttl))
+	if err != nil {
+		return 0, err
+	}
+	if err, ok := resp.(error); ok {
+		return 0, err
+	}
+	if idx, ok := resp.(uint64); ok {
+		return idx, nil
+	}
+	return 0, fmt.Errorf("unexpected raft apply response type %T", resp)
+}
+
+// Delete proposes a Delete command to the Raft log and waits for it to be
+// committed and applied locally. It returns NotLeaderError if this node is
+// not the leader.
+func (n *Node) Delete(key string) error {
+	resp, err := n.propose(newDeleteCommand(key))
+	if err != nil {
+		return err
+	}
+	if resp != nil {
+		if err, ok := resp.(error); ok {
+			return err
+		}
+		return fmt.Errorf("unexpected raft apply response type %T", resp)
+	}
+	return nil
+}
+
+// CompareAndSwap proposes a CAS command to the Raft log and waits for it to
+// be committed and applied locally, mirroring KVStore.CompareAndSwap's
+// semantics (including CASMismatchError on a failed precondition). It
+// returns NotLeaderError if this node is not the leader.
+func (n *Node) CompareAndSwap(key string, value any, ttl *float64, cas uint64) (uint64, error) {
+	resp, err := n.propose(newCASCommand(key, value, ttl, cas))
+	if err != nil {
+		return 0, err
+	}
+	if err, ok := resp.(error); ok {
+		return 0, err
+	}
+	if idx, ok := resp.(uint64); ok {
+		return idx, nil
+	}
+	return 0, fmt.Errorf("unexpected raft apply response type %T", resp)
+}
+
+// CompareAndDelete proposes a CAS delete command to the Raft log and waits
+// for it to be committed and applied locally, mirroring
+// KVStore.CompareAndDelete's semantics. It returns NotLeaderError if this
+// node is not the leader.
+func (n *Node) CompareAndDelete(key string, cas uint64) error {
+	resp, err := n.propose(newCASDeleteCommand(key, cas))
+	if err != nil {
+		return err
+	}
+	if resp != nil {
+		if err, ok := resp.(error); ok {
+			return err
+		}
+		return fmt.Errorf("unexpected raft apply response type %T", resp)
+	}
+	return nil
+}
+
+// Acquire proposes an Acquire command to the Raft log and waits for it to be
+// committed and applied locally, mirroring KVStore.Acquire's semantics. It
+// returns NotLeaderError if this node is not the leader.
+func (n *Node) Acquire(key string, value any, ttl *float64, session string) (uint64, error) {
+	resp, err := n.propose(newAcquireCommand(key, value, ttl, session))
+	if err != nil {
+		return 0, err
+	}
+	if err, ok := resp.(error); ok {
+		return 0, err
+	}
+	if idx, ok := resp.(uint64); ok {
+		return idx, nil
+	}
+	return 0, fmt.Errorf("unexpected raft apply response type %T", resp)
+}
+
+// Release proposes a Release command to the Raft log and waits for it to be
+// committed and applied locally, mirroring KVStore.Release's semantics. It
+// returns NotLeaderError if this node is not the leader.
+func (n *Node) Release(key string, session string) error {
+	resp, err := n.propose(newReleaseCommand(key, session))
+	if err != nil {
+		return err
+	}
+	if resp != nil {
+		if err, ok := resp.(error); ok {
+			return err
+		}
+		return fmt.Errorf("unexpected raft apply response type %T", resp)
+	}
+	return nil
+}
+
+// Transaction proposes a Txn command to the Raft log and waits for it to be
+// committed and applied locally, mirroring KVStore.Transaction's semantics:
+// it returns a result per op and a non-nil error if any "cas" precondition
+// failed, in which case no op was applied. It returns NotLeaderError if this
+// node is not the leader.
+func (n *Node) Transaction(ops []core.TxnOp) ([]core.TxnResult, error) {
+	resp, err := n.propose(newTxnCommand(ops))
+	if err != nil {
+		return nil, err
+	}
+	result, ok := resp.(txnApplyResult)
+	if !ok {
+		return nil, fmt.Errorf("unexpected raft apply response type %T", resp)
+	}
+	return result.results, result.err
+}
+
+// Get reads key from the local KVStore without going through Raft, so it
+// may return a stale value if this node has not yet applied the latest
+// committed writes. Linearizable reads should be proxied to the leader
+// instead (see the /cluster/status leader address).
+func (n *Node) Get(key string) (any, uint64, error) {
+	return n.kv.Get(context.Background(), key)
+}
+
+// Join adds nodeID, reachable at addr, as a voting member of the cluster.
+// It must be called against the current leader.
+func (n *Node) Join(nodeID string, addr string) error {
+	if !n.IsLeader() {
+		return NewNotLeaderError(string(n.raft.Leader()))
+	}
+	future := n.raft.AddVoter(raft.ServerID(nodeID), raft.ServerAddress(addr), 0, 0)
+	return future.Error()
+}
+
+// Leave removes nodeID from the cluster's voting configuration. It must be
+// called against the current leader.
+func (n *Node) Leave(nodeID string) error {
+	if !n.IsLeader() {
+		return NewNotLeaderError(string(n.raft.Leader()))
+	}
+	future := n.raft.RemoveServer(raft.ServerID(nodeID), 0, 0)
+	return future.Error()
+}
+
+// Server describes one member of the cluster's voting configuration, as
+// reported by Status.
+type Server struct {
+	ID      string `json:"id"`
+	Address string `json:"address"`
+}
+
+// Status summarizes this node's view of the cluster for the
+// /cluster/status endpoint.
+type Status struct {
+	ID         string   `json:"id"`
+	State      string   `json:"state"`
+	LeaderAddr string   `json:"leader_addr,omitempty"`
+	Servers    []Server `json:"servers"`
+}
+
+// Status reports this node's Raft state, the current leader (if known), and
+// the cluster's voting configuration.
+func (n *Node) Status() (Status, error) {
+	status := Status{
+		ID:         n.ID,
+		State:      n.raft.State().String(),
+		LeaderAddr: string(n.raft.Leader()),
+	}
+	future := n.raft.GetConfiguration()
+	if err := future.Error(); err != nil {
+		return status, err
+	}
+	for _, server := range future.Configuration().Servers {
+		status.Servers = append(status.Servers, Server{ID: string(server.ID), Address: string(server.Address)})
+	}
+	return status, nil
+}
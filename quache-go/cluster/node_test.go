@@ -0,0 +1,156 @@
+package cluster
+
+import (
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/AstraBert/quache/quache-go/core"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func testLogger() *logrus.Logger {
+	logger := logrus.New()
+	logger.Out = io.Discard
+	return logger
+}
+
+// newTestNode bootstraps a single-node cluster rooted at a fresh temp
+// directory and waits for it to elect itself leader, which a lone
+// bootstrapped node always does almost immediately.
+func newTestNode(t *testing.T) *Node {
+	t.Helper()
+	kv := core.NewKVStore(3, t.TempDir())
+	node, err := NewNode(Config{
+		NodeID:    "node-1",
+		BindAddr:  "127.0.0.1:0",
+		DataDir:   t.TempDir(),
+		Bootstrap: true,
+		KVStore:   kv,
+	}, testLogger())
+	if err != nil {
+		t.Fatalf("An error occurred while starting the node: %s", err.Error())
+	}
+	waitForLeader(t, node)
+	return node
+}
+
+func waitForLeader(t *testing.T, node *Node) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if node.IsLeader() {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("node never became leader")
+}
+
+func TestNodePutAndGet(t *testing.T) {
+	node := newTestNode(t)
+	idx, err := node.Put("hello", float64(1), nil)
+	assert.Nil(t, err, "Error should be nil when putting through the leader")
+	assert.Equal(t, uint64(1), idx)
+
+	value, modifyIndex, err := node.Get("hello")
+	assert.Nil(t, err, "Error should be nil when reading a key that was just put")
+	assert.Equal(t, float64(1), value)
+	assert.Equal(t, uint64(1), modifyIndex)
+}
+
+func TestNodeDelete(t *testing.T) {
+	node := newTestNode(t)
+	_, err := node.Put("hello", float64(1), nil)
+	assert.Nil(t, err, "Error should be nil when putting through the leader")
+
+	err = node.Delete("hello")
+	assert.Nil(t, err, "Error should be nil when deleting through the leader")
+
+	_, _, err = node.Get("hello")
+	assert.NotNil(t, err, "'hello' should have been removed by the deletion")
+}
+
+func TestNodeCompareAndSwap(t *testing.T) {
+	node := newTestNode(t)
+	idx, err := node.CompareAndSwap("hello", float64(1), nil, 0)
+	assert.Nil(t, err, "Error should be nil when creating a key via CAS")
+	assert.Equal(t, uint64(1), idx)
+
+	_, err = node.CompareAndSwap("hello", float64(2), nil, 0)
+	var casErr core.CASMismatchError
+	assert.True(t, errors.As(err, &casErr), "A conflicting CAS write should fail with a CASMismatchError")
+}
+
+func TestNodeCompareAndDelete(t *testing.T) {
+	node := newTestNode(t)
+	_, err := node.Put("hello", float64(1), nil)
+	assert.Nil(t, err, "Error should be nil when putting through the leader")
+
+	err = node.CompareAndDelete("hello", 999)
+	assert.NotNil(t, err, "A CAS delete against the wrong modify index should fail")
+
+	_, modifyIndex, _ := node.Get("hello")
+	err = node.CompareAndDelete("hello", modifyIndex)
+	assert.Nil(t, err, "A CAS delete against the correct modify index should succeed")
+	_, _, err = node.Get("hello")
+	assert.NotNil(t, err, "'hello' should have been removed")
+}
+
+func TestNodeAcquireAndRelease(t *testing.T) {
+	node := newTestNode(t)
+	session := node.kv.CreateSession(nil)
+
+	_, err := node.Acquire("hello", float64(1), nil, session.ID)
+	assert.Nil(t, err, "Error should be nil when acquiring an unlocked key")
+
+	err = node.Release("hello", session.ID)
+	assert.Nil(t, err, "Error should be nil when releasing a lock this session holds")
+}
+
+func TestNodeTransaction(t *testing.T) {
+	node := newTestNode(t)
+	_, err := node.Put("hello", float64(1), nil)
+	assert.Nil(t, err, "Error should be nil when putting through the leader")
+
+	results, err := node.Transaction([]core.TxnOp{
+		{Verb: "set", Key: "bye", Value: float64(2)},
+		{Verb: "delete", Key: "hello"},
+	})
+	assert.Nil(t, err, "Error should be nil when every op in the transaction succeeds")
+	assert.Len(t, results, 2)
+
+	_, _, err = node.Get("bye")
+	assert.Nil(t, err, "'bye' should have been created by the transaction")
+	_, _, err = node.Get("hello")
+	assert.NotNil(t, err, "'hello' should have been deleted by the transaction")
+}
+
+func TestNodePutNotLeaderBeforeElection(t *testing.T) {
+	kv := core.NewKVStore(3, t.TempDir())
+	node, err := NewNode(Config{
+		NodeID:    "node-1",
+		BindAddr:  "127.0.0.1:0",
+		DataDir:   t.TempDir(),
+		Bootstrap: false,
+		KVStore:   kv,
+	}, testLogger())
+	if err != nil {
+		t.Fatalf("An error occurred while starting the node: %s", err.Error())
+	}
+
+	_, err = node.Put("hello", float64(1), nil)
+	var notLeaderErr NotLeaderError
+	assert.True(t, errors.As(err, &notLeaderErr), "Put on a node that never bootstrapped or joined a cluster should fail with NotLeaderError")
+}
+
+func TestNodeStatus(t *testing.T) {
+	node := newTestNode(t)
+	status, err := node.Status()
+	assert.Nil(t, err, "Error should be nil when reading status")
+	assert.Equal(t, "node-1", status.ID)
+	assert.Equal(t, "Leader", status.State)
+	assert.Len(t, status.Servers, 1)
+}
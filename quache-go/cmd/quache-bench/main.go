@@ -0,0 +1,444 @@
+// Command quache-bench drives a mixed read/write/delete workload against a
+// running quache server and reports latency percentiles and throughput, so
+// changes to the store can be judged on tail behavior rather than just a
+// mean response time.
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/AstraBert/quache/quache-go/logging"
+)
+
+type SetRequest struct {
+	Key   string   `json:"key"`
+	Value any      `json:"value"`
+	Ttl   *float64 `json:"ttl"`
+}
+
+// workloadMix is the relative weight given to reads, writes, and deletes
+// when picking which operation to issue next. Weights need not sum to 100;
+// they are normalized against their own total.
+type workloadMix struct {
+	Reads, Writes, Deletes float64
+}
+
+// parseMix parses a "-mix=R:W:D" flag value, e.g. "80:15:5".
+func parseMix(s string) (workloadMix, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 {
+		return workloadMix{}, fmt.Errorf("mix %q must have the form read:write:delete", s)
+	}
+	values := make([]float64, 3)
+	for i, part := range parts {
+		v, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return workloadMix{}, fmt.Errorf("mix %q has a non-numeric weight: %w", s, err)
+		}
+		values[i] = v
+	}
+	mix := workloadMix{Reads: values[0], Writes: values[1], Deletes: values[2]}
+	if mix.Reads+mix.Writes+mix.Deletes <= 0 {
+		return workloadMix{}, fmt.Errorf("mix %q must have at least one positive weight", s)
+	}
+	return mix, nil
+}
+
+// opKind is the operation an iteration of the workload issues.
+type opKind int
+
+const (
+	opRead opKind = iota
+	opWrite
+	opDelete
+)
+
+// picker draws ops from mix's distribution. Each goroutine gets its own
+// picker (and *rand.Rand) since math/rand's global functions serialize on a
+// shared lock under high concurrency.
+type picker struct {
+	rng                      *rand.Rand
+	readCut, writeCut, total float64
+}
+
+func newPicker(mix workloadMix, seed int64) *picker {
+	return &picker{
+		rng:      rand.New(rand.NewSource(seed)),
+		readCut:  mix.Reads,
+		writeCut: mix.Reads + mix.Writes,
+		total:    mix.Reads + mix.Writes + mix.Deletes,
+	}
+}
+
+func (p *picker) next() opKind {
+	roll := p.rng.Float64() * p.total
+	switch {
+	case roll < p.readCut:
+		return opRead
+	case roll < p.writeCut:
+		return opWrite
+	default:
+		return opDelete
+	}
+}
+
+// keyGenerator draws a key index in [0, keyspace) from either a uniform or
+// a Zipfian distribution. Zipfian access lets the benchmark model the
+// skewed "hot key" traffic a real deployment sees, where cache locality (and
+// therefore shard/lock contention) matters far more than under uniform
+// access.
+type keyGenerator struct {
+	uniform *rand.Rand
+	zipf    *rand.Zipf
+}
+
+func newKeyGenerator(dist string, keyspace uint64, zipfSkew float64, seed int64) (*keyGenerator, error) {
+	rng := rand.New(rand.NewSource(seed))
+	switch dist {
+	case "uniform":
+		return &keyGenerator{uniform: rng}, nil
+	case "zipf":
+		zipf := rand.NewZipf(rng, zipfSkew, 1, keyspace-1)
+		if zipf == nil {
+			return nil, fmt.Errorf("invalid zipf parameters: -zipf-skew must be > 1")
+		}
+		return &keyGenerator{zipf: zipf}, nil
+	default:
+		return nil, fmt.Errorf("unknown -dist %q: expected uniform or zipf", dist)
+	}
+}
+
+func (g *keyGenerator) next(keyspace uint64) string {
+	if g.zipf != nil {
+		return fmt.Sprintf("key-%d", g.zipf.Uint64())
+	}
+	return fmt.Sprintf("key-%d", g.uniform.Int63n(int64(keyspace)))
+}
+
+// histogramBuckets covers latencies up to 2^(histogramBuckets-1)
+// microseconds (~36 minutes), far beyond anything a benchmark run should
+// see; slower samples are counted in the last bucket.
+const histogramBuckets = 32
+
+// latencyHistogram is a simplified HDR-style histogram: instead of
+// retaining every sample, it buckets latencies by power-of-two microsecond
+// boundaries and derives percentiles from the bucket counts. This keeps
+// memory use constant regardless of request count, the same tradeoff full
+// HDR histogram implementations make.
+type latencyHistogram struct {
+	mu      sync.Mutex
+	buckets [histogramBuckets]uint64
+	count   uint64
+}
+
+func (h *latencyHistogram) Record(d time.Duration) {
+	micros := uint64(d.Microseconds())
+	bucket := bits.Len64(micros)
+	if bucket >= histogramBuckets {
+		bucket = histogramBuckets - 1
+	}
+	h.mu.Lock()
+	h.buckets[bucket]++
+	h.count++
+	h.mu.Unlock()
+}
+
+// Percentile returns the upper bound, in milliseconds, of the bucket
+// containing the p-th percentile sample (0 < p <= 1).
+func (h *latencyHistogram) Percentile(p float64) float64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.count == 0 {
+		return 0
+	}
+	target := uint64(math.Ceil(p * float64(h.count)))
+	var cumulative uint64
+	for i, c := range h.buckets {
+		cumulative += c
+		if cumulative >= target {
+			return float64(uint64(1)<<i) / 1000.0
+		}
+	}
+	return float64(uint64(1)<<(histogramBuckets-1)) / 1000.0
+}
+
+type stats struct {
+	success atomic.Int64
+	failed  atomic.Int64
+	reads   atomic.Int64
+	writes  atomic.Int64
+	deletes atomic.Int64
+	latency latencyHistogram
+}
+
+func doRead(client *http.Client, addr, key string) (int, error) {
+	resp, err := client.Get(addr + "/kv/" + key)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	return resp.StatusCode, nil
+}
+
+func doWrite(client *http.Client, addr, key string, rng *rand.Rand) (int, error) {
+	ttl := rng.Float64() * 60
+	body, err := json.Marshal(SetRequest{Key: key, Value: rng.Intn(1_000_000), Ttl: &ttl})
+	if err != nil {
+		return 0, err
+	}
+	resp, err := client.Post(addr+"/kv", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	return resp.StatusCode, nil
+}
+
+func doDelete(client *http.Client, addr, key string) (int, error) {
+	req, err := http.NewRequest(http.MethodDelete, addr+"/kv/"+key, nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	return resp.StatusCode, nil
+}
+
+// summary is the final report, marshaled as JSON or flattened to CSV
+// depending on -format.
+type summary struct {
+	TotalRequests     int64   `json:"total_requests"`
+	Successful        int64   `json:"successful"`
+	Failed            int64   `json:"failed"`
+	SuccessRatePct    float64 `json:"success_rate_pct"`
+	Reads             int64   `json:"reads"`
+	Writes            int64   `json:"writes"`
+	Deletes           int64   `json:"deletes"`
+	Concurrency       int     `json:"concurrency"`
+	Keyspace          uint64  `json:"keyspace"`
+	Distribution      string  `json:"distribution"`
+	DurationSeconds   float64 `json:"duration_seconds"`
+	RequestsPerSecond float64 `json:"requests_per_second"`
+	P50Ms             float64 `json:"p50_ms"`
+	P95Ms             float64 `json:"p95_ms"`
+	P99Ms             float64 `json:"p99_ms"`
+	P999Ms            float64 `json:"p999_ms"`
+	ThroughputSamples []int64 `json:"throughput_samples_per_second"`
+}
+
+func (s summary) writeText(w io.Writer) {
+	fmt.Fprintf(w, "Total requests: %d\n", s.TotalRequests)
+	fmt.Fprintf(w, "Successful requests: %d\n", s.Successful)
+	fmt.Fprintf(w, "Failed requests: %d\n", s.Failed)
+	fmt.Fprintf(w, "Success rate: %.2f%%\n", s.SuccessRatePct)
+	fmt.Fprintf(w, "Reads/Writes/Deletes: %d/%d/%d\n", s.Reads, s.Writes, s.Deletes)
+	fmt.Fprintf(w, "Total test duration: %.2fs\n", s.DurationSeconds)
+	fmt.Fprintf(w, "Requests per second: %.2f\n", s.RequestsPerSecond)
+	fmt.Fprintf(w, "Latency p50/p95/p99/p999 (ms): %.2f / %.2f / %.2f / %.2f\n", s.P50Ms, s.P95Ms, s.P99Ms, s.P999Ms)
+}
+
+func (s summary) writeJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(s)
+}
+
+func (s summary) writeCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	defer writer.Flush()
+	rows := [][]string{
+		{"metric", "value"},
+		{"total_requests", strconv.FormatInt(s.TotalRequests, 10)},
+		{"successful", strconv.FormatInt(s.Successful, 10)},
+		{"failed", strconv.FormatInt(s.Failed, 10)},
+		{"success_rate_pct", strconv.FormatFloat(s.SuccessRatePct, 'f', 2, 64)},
+		{"reads", strconv.FormatInt(s.Reads, 10)},
+		{"writes", strconv.FormatInt(s.Writes, 10)},
+		{"deletes", strconv.FormatInt(s.Deletes, 10)},
+		{"duration_seconds", strconv.FormatFloat(s.DurationSeconds, 'f', 2, 64)},
+		{"requests_per_second", strconv.FormatFloat(s.RequestsPerSecond, 'f', 2, 64)},
+		{"p50_ms", strconv.FormatFloat(s.P50Ms, 'f', 2, 64)},
+		{"p95_ms", strconv.FormatFloat(s.P95Ms, 'f', 2, 64)},
+		{"p99_ms", strconv.FormatFloat(s.P99Ms, 'f', 2, 64)},
+		{"p999_ms", strconv.FormatFloat(s.P999Ms, 'f', 2, 64)},
+	}
+	for i, sample := range s.ThroughputSamples {
+		rows = append(rows, []string{fmt.Sprintf("throughput_second_%d", i+1), strconv.FormatInt(sample, 10)})
+	}
+	return writer.WriteAll(rows)
+}
+
+func main() {
+	addr := flag.String("addr", "http://0.0.0.0:8000", "Base URL of the quache server under test")
+	requests := flag.Int("n", 0, "Total number of requests to issue (required)")
+	concurrency := flag.Int("concurrency", 1000, "Number of in-flight requests at a time")
+	mixFlag := flag.String("mix", "80:15:5", "Read:write:delete workload mix, e.g. 80:15:5")
+	keyspace := flag.Uint64("keys", 10000, "Number of distinct keys to spread requests over")
+	dist := flag.String("dist", "uniform", "Key access distribution: uniform or zipf")
+	zipfSkew := flag.Float64("zipf-skew", 1.2, "Zipf skew parameter (s > 1); higher means hotter keys. Only used with -dist=zipf")
+	format := flag.String("format", "text", "Summary output format: text, csv, or json")
+	output := flag.String("output", "", "File to write the summary to; defaults to stdout")
+	logLevel := flag.String("log-level", logging.DefaultLevel, "Logging level (debug, info, warn, error). Defaults to info")
+	logFormat := flag.String("log-format", logging.DefaultFormat, "Logging format (text, json). Defaults to text")
+	flag.Parse()
+
+	logger := logging.New(*logLevel, *logFormat)
+
+	if *requests <= 0 {
+		logger.Fatal("-n must be a positive number of requests")
+	}
+	mix, err := parseMix(*mixFlag)
+	if err != nil {
+		logger.Fatalf("invalid -mix: %s", err.Error())
+	}
+	keyGen, err := newKeyGenerator(*dist, *keyspace, *zipfSkew, time.Now().UnixNano())
+	if err != nil {
+		logger.Fatalf("invalid key distribution: %s", err.Error())
+	}
+
+	transport := &http.Transport{
+		MaxIdleConns:        *concurrency,
+		MaxIdleConnsPerHost: *concurrency,
+		MaxConnsPerHost:     *concurrency,
+		IdleConnTimeout:     90 * time.Second,
+	}
+	client := &http.Client{Timeout: 10 * time.Second, Transport: transport}
+
+	var s stats
+	semaphore := make(chan struct{}, *concurrency)
+	var wg sync.WaitGroup
+
+	var throughputSamples []int64
+	var lastCount int64
+	stopThroughput := make(chan struct{})
+	var throughputWg sync.WaitGroup
+	throughputWg.Add(1)
+	go func() {
+		defer throughputWg.Done()
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				current := s.success.Load() + s.failed.Load()
+				throughputSamples = append(throughputSamples, current-lastCount)
+				lastCount = current
+			case <-stopThroughput:
+				return
+			}
+		}
+	}()
+
+	startTime := time.Now()
+	for i := range *requests {
+		wg.Add(1)
+		semaphore <- struct{}{} // Acquire semaphore
+
+		go func(seed int64) {
+			defer wg.Done()
+			defer func() { <-semaphore }() // Release semaphore
+
+			rng := rand.New(rand.NewSource(seed))
+			op := newPicker(mix, seed).next()
+			key := keyGen.next(*keyspace)
+
+			start := time.Now()
+			var statusCode int
+			var reqErr error
+			switch op {
+			case opRead:
+				s.reads.Add(1)
+				statusCode, reqErr = doRead(client, *addr, key)
+			case opWrite:
+				s.writes.Add(1)
+				statusCode, reqErr = doWrite(client, *addr, key, rng)
+			case opDelete:
+				s.deletes.Add(1)
+				statusCode, reqErr = doDelete(client, *addr, key)
+			}
+			elapsed := time.Since(start)
+
+			if reqErr != nil || statusCode >= 400 {
+				s.failed.Add(1)
+				return
+			}
+			s.latency.Record(elapsed)
+			s.success.Add(1)
+		}(int64(i) + startTime.UnixNano())
+	}
+
+	wg.Wait()
+	close(stopThroughput)
+	throughputWg.Wait()
+	totalDuration := time.Since(startTime)
+
+	successCount := s.success.Load()
+	failedCount := s.failed.Load()
+	total := successCount + failedCount
+
+	result := summary{
+		TotalRequests:     total,
+		Successful:        successCount,
+		Failed:            failedCount,
+		SuccessRatePct:    float64(successCount) / float64(total) * 100,
+		Reads:             s.reads.Load(),
+		Writes:            s.writes.Load(),
+		Deletes:           s.deletes.Load(),
+		Concurrency:       *concurrency,
+		Keyspace:          *keyspace,
+		Distribution:      *dist,
+		DurationSeconds:   totalDuration.Seconds(),
+		RequestsPerSecond: float64(total) / totalDuration.Seconds(),
+		P50Ms:             s.latency.Percentile(0.50),
+		P95Ms:             s.latency.Percentile(0.95),
+		P99Ms:             s.latency.Percentile(0.99),
+		P999Ms:            s.latency.Percentile(0.999),
+		ThroughputSamples: throughputSamples,
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			logger.Fatalf("could not create -output file: %s", err.Error())
+		}
+		defer f.Close()
+		w = f
+	}
+
+	switch *format {
+	case "text":
+		result.writeText(w)
+	case "json":
+		if err := result.writeJSON(w); err != nil {
+			logger.Fatalf("could not write JSON summary: %s", err.Error())
+		}
+	case "csv":
+		if err := result.writeCSV(w); err != nil {
+			logger.Fatalf("could not write CSV summary: %s", err.Error())
+		}
+	default:
+		logger.Fatalf("unknown -format %q: expected text, csv, or json", *format)
+	}
+}
@@ -11,7 +11,10 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/AstraBert/quache/quache-go/cluster"
 	"github.com/AstraBert/quache/quache-go/core"
+	"github.com/AstraBert/quache/quache-go/logging"
+	"github.com/AstraBert/quache/quache-go/metrics"
 	"github.com/AstraBert/quache/quache-go/server"
 	"github.com/AstraBert/quache/quache-go/workers"
 	"github.com/spf13/cobra"
@@ -23,6 +26,10 @@ const DefaultFlushingInterval int = 1000
 const DefaultCleanupInterval int = 500
 const DefaultDirectory string = ".quache/"
 const DefaultShardsNumber int = 5
+const DefaultLogLevel string = logging.DefaultLevel
+const DefaultLogFormat string = logging.DefaultFormat
+const DefaultBackend string = "file"
+const DefaultWALFsync string = "interval"
 
 var port int
 var host string
@@ -32,6 +39,34 @@ var directory string
 var shardsNumber int
 var showHelp bool
 var load bool
+var logLevel string
+var logFormat string
+var metricsBind string
+var backendKind string
+var clusterEnable bool
+var clusterNodeID string
+var clusterBindAddr string
+var clusterBootstrap bool
+var clusterDataDir string
+var walEnable bool
+var walFsync string
+
+// buildBackend constructs the persistence backend named by kind, rooted at
+// directory. Supported kinds are "file" (the default, whole-shard JSON
+// dumps), "bolt" (one BoltDB bucket per shard) and "memory" (no durability,
+// for tests or ephemeral deployments).
+func buildBackend(kind string, directory string) (core.Backend, error) {
+	switch kind {
+	case "", DefaultBackend:
+		return core.NewFileBackend(directory), nil
+	case "bolt":
+		return core.NewBoltBackend(directory)
+	case "memory":
+		return core.NewMemoryBackend(), nil
+	default:
+		return nil, fmt.Errorf("unknown backend %q: expected file, bolt, or memory", kind)
+	}
+}
 
 var rootCmd = &cobra.Command{
 	Use:   "quache",
@@ -42,26 +77,69 @@ var rootCmd = &cobra.Command{
 			_ = cmd.Help()
 			return
 		}
+		logger := logging.New(logLevel, logFormat)
 		_, err := os.Stat(directory)
 		if errors.Is(err, os.ErrNotExist) {
 			if load {
-				fmt.Println("Cannot load the KV store from the specified directory because it does not exist")
-				os.Exit(1)
+				logger.Fatal("Cannot load the KV store from the specified directory because it does not exist")
 			}
 			os.Mkdir(directory, 0775)
 		}
+		backend, err := buildBackend(backendKind, directory)
+		if err != nil {
+			logger.Fatal(err.Error())
+		}
 		var kvStore *core.KVStore
 		if load {
-			fmt.Println("Loading KV store from disk...")
-			kvStore, err = core.NewKVStoreFromDisk(shardsNumber, directory)
+			logger.Info("Loading KV store from disk...")
+			kvStore, err = core.NewKVStoreFromBackend(shardsNumber, directory, backend)
 			if err != nil {
-				fmt.Println(err.Error())
-				os.Exit(1)
+				logger.Fatal(err.Error())
 			}
 		} else {
 			kvStore = core.NewKVStore(shardsNumber, directory)
+			kvStore.SetBackend(backend)
+		}
+		kvStore.SetLogger(logger)
+
+		if walEnable {
+			fsyncPolicy := core.WALFsyncPolicy(walFsync)
+			switch fsyncPolicy {
+			case core.WALFsyncAlways, core.WALFsyncInterval, core.WALFsyncOff:
+			default:
+				logger.Fatalf("unknown --wal-fsync %q: expected always, interval, or off", walFsync)
+			}
+			wal, err := core.NewWAL(directory, shardsNumber, fsyncPolicy)
+			if err != nil {
+				logger.Fatal(err.Error())
+			}
+			if load {
+				if err := kvStore.ReplayWAL(wal); err != nil {
+					logger.Fatal(err.Error())
+				}
+			} else {
+				kvStore.SetWAL(wal)
+			}
+		}
+
+		var clusterNode *cluster.Node
+		if clusterEnable {
+			if err := os.MkdirAll(clusterDataDir, 0775); err != nil {
+				logger.Fatal(err.Error())
+			}
+			clusterNode, err = cluster.NewNode(cluster.Config{
+				NodeID:    clusterNodeID,
+				BindAddr:  clusterBindAddr,
+				DataDir:   clusterDataDir,
+				Bootstrap: clusterBootstrap,
+				KVStore:   kvStore,
+			}, logger)
+			if err != nil {
+				logger.Fatal(err.Error())
+			}
 		}
-		handler := server.CreateServerMux(kvStore)
+
+		handler := server.CreateServerMux(kvStore, logger, clusterNode)
 		ctx, cancel := context.WithCancel(context.Background())
 		defer cancel()
 
@@ -78,34 +156,58 @@ var rootCmd = &cobra.Command{
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			workers.ToDiskWorker(kvStore, flushingInterval, done, ctx)
+			workers.ToDiskWorker(kvStore, logger, flushingInterval, done, ctx)
 		}()
 
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			workers.CleanupWorker(kvStore, cleanupInterval, done, ctx)
+			workers.CleanupWorker(kvStore, logger, cleanupInterval, done, ctx)
 		}()
 
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			workers.SessionCleanupWorker(kvStore, logger, cleanupInterval, done, ctx)
+		}()
+
+		var metricsServer *http.Server
+		if metricsBind != "" {
+			metricsMux := http.NewServeMux()
+			metricsMux.Handle("GET /metrics", metrics.Handler())
+			metricsServer = &http.Server{Addr: metricsBind, Handler: metricsMux}
+			go func() {
+				logger.WithField("addr", metricsBind).Info("starting metrics server")
+				if err := metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+					logger.WithError(err).Error("metrics server error")
+				}
+			}()
+		}
+
 		// Start server in a goroutine
 		go func() {
-			fmt.Println("starting server on :8000")
+			logger.WithField("addr", httpServer.Addr).Info("starting server")
 			if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-				fmt.Printf("Server error: %s\n", err)
+				logger.WithError(err).Error("server error")
 			}
 		}()
 
 		<-done
-		fmt.Println("Shutting down server and workers...")
+		logger.Info("Shutting down server and workers...")
 
 		shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer shutdownCancel()
 		if err := httpServer.Shutdown(shutdownCtx); err != nil {
-			fmt.Printf("Server shutdown error: %s\n", err)
+			logger.WithError(err).Error("server shutdown error")
+		}
+		if metricsServer != nil {
+			if err := metricsServer.Shutdown(shutdownCtx); err != nil {
+				logger.WithError(err).Error("metrics server shutdown error")
+			}
 		}
 		cancel()
 		wg.Wait()
-		fmt.Println("Application stopped")
+		logger.Info("Application stopped")
 	},
 }
 
@@ -125,4 +227,15 @@ func init() {
 	rootCmd.Flags().IntVarP(&cleanupInterval, "cleanup-interval", "c", DefaultCleanupInterval, "Cleanup (of expired entries) interval (in ms). Defaults to 5ß0ms")
 	rootCmd.Flags().StringVarP(&host, "bind", "b", DefaultHost, "Host to bind the server to. Defaults to 0.0.0.0")
 	rootCmd.Flags().IntVarP(&port, "port", "p", DefaultPort, "Port to which to bind the server to. Defaults to 8000")
+	rootCmd.Flags().StringVar(&logLevel, "log-level", DefaultLogLevel, "Logging level (debug, info, warn, error). Defaults to info")
+	rootCmd.Flags().StringVar(&logFormat, "log-format", DefaultLogFormat, "Logging format (text, json). Defaults to text")
+	rootCmd.Flags().StringVar(&metricsBind, "metrics-bind", "", "Address to serve Prometheus metrics on a separate listener (e.g. 0.0.0.0:9090). Metrics are always served on the main listener's /metrics too; empty disables the separate listener")
+	rootCmd.Flags().StringVar(&backendKind, "backend", DefaultBackend, "Persistence backend to use: file, bolt, or memory. Defaults to file")
+	rootCmd.Flags().BoolVar(&clusterEnable, "cluster-enable", false, "Run this node as part of a Raft-replicated cluster. Disabled by default (standalone node)")
+	rootCmd.Flags().StringVar(&clusterNodeID, "cluster-node-id", "", "Unique ID for this node within the cluster. Required when --cluster-enable is set")
+	rootCmd.Flags().StringVar(&clusterBindAddr, "cluster-bind", "127.0.0.1:7000", "Address Raft uses to replicate log entries with other nodes")
+	rootCmd.Flags().BoolVar(&clusterBootstrap, "cluster-bootstrap", false, "Bootstrap a brand-new single-node cluster on startup, rather than joining an existing one")
+	rootCmd.Flags().StringVar(&clusterDataDir, "cluster-data-dir", ".quache-raft/", "Directory for this node's Raft log, stable store, and snapshots")
+	rootCmd.Flags().BoolVar(&walEnable, "wal-enable", false, "Append every write to a write-ahead log before applying it in memory, so writes between two --flush-interval checkpoints survive a crash. Disabled by default")
+	rootCmd.Flags().StringVar(&walFsync, "wal-fsync", DefaultWALFsync, "WAL fsync policy: always, interval, or off. Defaults to interval")
 }
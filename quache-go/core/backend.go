@@ -0,0 +1,17 @@
+package core
+
+// Backend persists and loads the key/value data for a single shard,
+// decoupling KVStore's snapshot lifecycle from how and where that data is
+// actually stored. This mirrors the multi-backend abstraction used by
+// libraries like libkv (Consul/Etcd/Zookeeper/BoltDB): a KVStore can be
+// pointed at whichever backend fits its durability and throughput needs via
+// SetBackend/NewKVStoreFromBackend, without changing any of its own code.
+type Backend interface {
+	// LoadShard returns the persisted entries for shard id, keyed by their
+	// key, or an empty map (with a nil error) if nothing has been persisted
+	// for that shard yet.
+	LoadShard(id int) (map[string]Entry, error)
+	// PersistShard durably stores data as the complete contents of shard id,
+	// replacing whatever was previously persisted for it.
+	PersistShard(id int, data map[string]Entry) error
+}
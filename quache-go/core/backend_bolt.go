@@ -0,0 +1,81 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+
+	"go.etcd.io/bbolt"
+)
+
+// BoltBackend persists shards in a single BoltDB file, one bucket per shard
+// and one JSON-encoded Entry per key. Unlike FileBackend's whole-shard
+// dumps, each PersistShard call lands key-by-key in a single durable
+// transaction, at the cost of slower bulk snapshots.
+type BoltBackend struct {
+	db *bbolt.DB
+}
+
+// NewBoltBackend opens (creating if necessary) a BoltDB file named
+// quache.db inside directory.
+func NewBoltBackend(directory string) (*BoltBackend, error) {
+	db, err := bbolt.Open(path.Join(directory, "quache.db"), 0644, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &BoltBackend{db: db}, nil
+}
+
+// Close releases the underlying BoltDB file handle.
+func (b *BoltBackend) Close() error {
+	return b.db.Close()
+}
+
+func boltBucketName(id int) []byte {
+	return []byte(fmt.Sprintf("shard-%d", id))
+}
+
+func (b *BoltBackend) LoadShard(id int) (map[string]Entry, error) {
+	data := make(map[string]Entry)
+	err := b.db.View(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(boltBucketName(id))
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(k, v []byte) error {
+			var entry Entry
+			if err := json.Unmarshal(v, &entry); err != nil {
+				return err
+			}
+			data[string(k)] = entry
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, NewUnloadableShardError(id, err.Error())
+	}
+	return data, nil
+}
+
+func (b *BoltBackend) PersistShard(id int, data map[string]Entry) error {
+	return b.db.Update(func(tx *bbolt.Tx) error {
+		name := boltBucketName(id)
+		if err := tx.DeleteBucket(name); err != nil && err != bbolt.ErrBucketNotFound {
+			return err
+		}
+		bucket, err := tx.CreateBucket(name)
+		if err != nil {
+			return err
+		}
+		for key, entry := range data {
+			encoded, err := json.Marshal(entry)
+			if err != nil {
+				return err
+			}
+			if err := bucket.Put([]byte(key), encoded); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,54 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBoltBackendPersistAndLoad(t *testing.T) {
+	err := makeTestBackendDirectory()
+	if err != nil {
+		t.Fatalf("An error occurred while creating the test directory: %s", err.Error())
+	}
+	defer func() { _ = cleanupTestBackendDirectory() }()
+
+	backend, err := NewBoltBackend(TestBackendDirectory)
+	if err != nil {
+		t.Fatalf("An error occurred while opening the bolt backend: %s", err.Error())
+	}
+	defer func() { _ = backend.Close() }()
+
+	data := map[string]Entry{
+		"hello": {Key: "hello", Value: float64(1), Timestamp: 123, Ttl: -1, ModifyIndex: 1},
+	}
+	err = backend.PersistShard(0, data)
+	assert.Nil(t, err, "Error should be nil when persisting a shard")
+
+	loaded, err := backend.LoadShard(0)
+	assert.Nil(t, err, "Error should be nil when loading a persisted shard")
+	entry, ok := loaded["hello"]
+	assert.True(t, ok, "Loaded shard should contain 'hello'")
+	if ok {
+		assert.Equal(t, entry.Value, float64(1))
+		assert.Equal(t, entry.ModifyIndex, uint64(1))
+	}
+}
+
+func TestBoltBackendLoadMissingShardIsEmpty(t *testing.T) {
+	err := makeTestBackendDirectory()
+	if err != nil {
+		t.Fatalf("An error occurred while creating the test directory: %s", err.Error())
+	}
+	defer func() { _ = cleanupTestBackendDirectory() }()
+
+	backend, err := NewBoltBackend(TestBackendDirectory)
+	if err != nil {
+		t.Fatalf("An error occurred while opening the bolt backend: %s", err.Error())
+	}
+	defer func() { _ = backend.Close() }()
+
+	loaded, err := backend.LoadShard(99)
+	assert.Nil(t, err, "Error should be nil when the shard bucket does not exist")
+	assert.Len(t, loaded, 0, "A never-persisted shard should load as empty")
+}
@@ -0,0 +1,73 @@
+package core
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"strings"
+)
+
+// FileBackend is quache's original persistence strategy: each shard is
+// dumped in full to its own file as an MD5-checked JSON blob. It favors
+// fast bulk snapshots over per-key durability.
+type FileBackend struct {
+	Directory string
+}
+
+func NewFileBackend(directory string) *FileBackend {
+	return &FileBackend{Directory: directory}
+}
+
+func (b *FileBackend) shardFile(id int) string {
+	return path.Join(b.Directory, fmt.Sprintf("shard-%d", id))
+}
+
+func (b *FileBackend) LoadShard(id int) (map[string]Entry, error) {
+	fileName := b.shardFile(id)
+	if _, err := os.Stat(fileName); errors.Is(err, os.ErrNotExist) {
+		return map[string]Entry{}, nil
+	}
+	bData, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, NewUnloadableShardError(id, err.Error())
+	}
+	bDataS := string(bData)
+	lines := strings.Split(bDataS, "\n")
+	integrityHashS := lines[len(lines)-1]
+	integrityHash, err := hex.DecodeString(integrityHashS)
+	if err != nil {
+		return nil, NewUnloadableShardError(id, err.Error())
+	}
+	mapData := []byte(strings.Join(lines[:len(lines)-1], "\n"))
+	actualHash := md5.Sum(mapData)
+	if !slices.Equal(actualHash[:], integrityHash) {
+		return nil, NewUnloadableShardError(id, "the computed hash does not match the integrity hash reported in the file")
+	}
+	var data map[string]Entry
+	if err := json.Unmarshal(mapData, &data); err != nil {
+		return nil, NewUnloadableShardError(id, err.Error())
+	}
+	return data, nil
+}
+
+func (b *FileBackend) PersistShard(id int, data map[string]Entry) error {
+	if len(data) == 0 {
+		if err := os.Remove(b.shardFile(id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	hash := md5.Sum(encoded)
+	integrityHash := hex.EncodeToString(hash[:])
+	toWrite := append(encoded, append([]byte("\n"), []byte(integrityHash)...)...)
+	return os.WriteFile(b.shardFile(id), toWrite, 0644)
+}
@@ -0,0 +1,32 @@
+package core
+
+import "sync"
+
+// MemoryBackend keeps persisted shard snapshots in memory instead of writing
+// them anywhere durable. It exists for tests and for setups that want to
+// exercise ToDisk's bookkeeping without touching disk; every PersistShard
+// call succeeds but is lost on process exit.
+type MemoryBackend struct {
+	mu     sync.RWMutex
+	shards map[int]map[string]Entry
+}
+
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{shards: make(map[int]map[string]Entry)}
+}
+
+func (b *MemoryBackend) LoadShard(id int) (map[string]Entry, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if data, ok := b.shards[id]; ok {
+		return data, nil
+	}
+	return map[string]Entry{}, nil
+}
+
+func (b *MemoryBackend) PersistShard(id int, data map[string]Entry) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.shards[id] = data
+	return nil
+}
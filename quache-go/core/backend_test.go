@@ -0,0 +1,88 @@
+package core
+
+import (
+	"context"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const TestBackendDirectory string = ".quache-backend-test/"
+
+func makeTestBackendDirectory() error {
+	if _, err := os.Stat(TestBackendDirectory); err == nil { // exists
+		return nil
+	}
+	return os.Mkdir(TestBackendDirectory, 0775)
+}
+
+func cleanupTestBackendDirectory() error {
+	if _, err := os.Stat(TestBackendDirectory); err != nil {
+		return nil
+	}
+	return os.RemoveAll(TestBackendDirectory)
+}
+
+func TestFileBackendPersistAndLoad(t *testing.T) {
+	err := makeTestBackendDirectory()
+	if err != nil {
+		t.Fatalf("An error occurred while creating the test directory: %s", err.Error())
+	}
+	defer func() { _ = cleanupTestBackendDirectory() }()
+
+	backend := NewFileBackend(TestBackendDirectory)
+	data := map[string]Entry{
+		"hello": {Key: "hello", Value: float64(1), Timestamp: 123, Ttl: -1, ModifyIndex: 1},
+	}
+	err = backend.PersistShard(0, data)
+	assert.Nil(t, err, "Error should be nil when persisting a shard")
+	assert.FileExists(t, path.Join(TestBackendDirectory, "shard-0"))
+
+	loaded, err := backend.LoadShard(0)
+	assert.Nil(t, err, "Error should be nil when loading a persisted shard")
+	entry, ok := loaded["hello"]
+	assert.True(t, ok, "Loaded shard should contain 'hello'")
+	if ok {
+		assert.Equal(t, entry.Value, float64(1))
+		assert.Equal(t, entry.ModifyIndex, uint64(1))
+	}
+}
+
+func TestFileBackendLoadMissingShardIsEmpty(t *testing.T) {
+	backend := NewFileBackend(TestBackendDirectory)
+	loaded, err := backend.LoadShard(99)
+	assert.Nil(t, err, "Error should be nil when the shard file does not exist")
+	assert.Len(t, loaded, 0, "A never-persisted shard should load as empty")
+}
+
+func TestMemoryBackendPersistAndLoad(t *testing.T) {
+	backend := NewMemoryBackend()
+	data := map[string]Entry{
+		"hello": {Key: "hello", Value: 1, ModifyIndex: 1},
+	}
+	err := backend.PersistShard(0, data)
+	assert.Nil(t, err, "Error should be nil when persisting a shard")
+	loaded, err := backend.LoadShard(0)
+	assert.Nil(t, err, "Error should be nil when loading a persisted shard")
+	assert.Equal(t, loaded["hello"].Value, 1)
+}
+
+func TestMemoryBackendLoadMissingShardIsEmpty(t *testing.T) {
+	backend := NewMemoryBackend()
+	loaded, err := backend.LoadShard(0)
+	assert.Nil(t, err, "Error should be nil when the shard was never persisted")
+	assert.Len(t, loaded, 0, "A never-persisted shard should load as empty")
+}
+
+func TestKVStoreWithMemoryBackendRoundTrips(t *testing.T) {
+	store := NewKVStore(3, TestDirectory)
+	store.SetBackend(NewMemoryBackend())
+	store.Put(context.Background(), "hello", 1, nil)
+	err := store.ToDisk(context.Background())
+	assert.Nil(t, err, "Error should be nil when persisting through a MemoryBackend")
+	loaded, err := store.backend.LoadShard(store.findShard("hello"))
+	assert.Nil(t, err, "Error should be nil when loading the persisted shard back")
+	assert.Equal(t, loaded["hello"].Value, 1)
+}
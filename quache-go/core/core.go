@@ -1,24 +1,27 @@
 package core
 
 import (
-	"crypto/md5"
-	"encoding/hex"
-	"encoding/json"
+	"context"
 	"errors"
 	"fmt"
 	"hash/crc32"
-	"os"
-	"path"
-	"slices"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/AstraBert/quache/quache-go/metrics"
+	"github.com/sirupsen/logrus"
 )
 
 type ShardEntry struct {
-	Value     any     `json:"value"`
-	Timestamp int64   `json:"timestamp"`
-	Ttl       float64 `json:"ttl"`
+	Value       any     `json:"value"`
+	Timestamp   int64   `json:"timestamp"`
+	Ttl         float64 `json:"ttl"`
+	ModifyIndex uint64  `json:"modify_index"`
+	Session     string  `json:"session,omitempty"`
+	LockIndex   uint64  `json:"lock_index,omitempty"`
 }
 
 type Shard struct {
@@ -30,6 +33,10 @@ type KVStore struct {
 	Shards          []*Shard
 	Directory       string
 	shardDimensions map[int]int
+	logger          *logrus.Logger
+	sessions        *SessionStore
+	backend         Backend
+	wal             *WAL
 }
 
 type KeyNotFoundError struct {
@@ -50,6 +57,15 @@ func (e ExpiredEntryError) Error() string {
 	return fmt.Sprintf("Key %s is expired (requested TTL: %f, elapsed: %d)", e.key, e.ttl, e.elapsed)
 }
 
+type CASMismatchError struct {
+	key      string
+	expected uint64
+}
+
+func (e CASMismatchError) Error() string {
+	return fmt.Sprintf("Key %s was not modified: it was not at the expected modify index %d", e.key, e.expected)
+}
+
 type UnloadableShardError struct {
 	shardNum  int
 	errorType string
@@ -59,12 +75,28 @@ func (e UnloadableShardError) Error() string {
 	return fmt.Sprintf("Shard %d could not be loaded because %s", e.shardNum, e.errorType)
 }
 
-func NewShardEntry(value any, ttl float64) *ShardEntry {
+// Entry is a flattened, read-only view of a ShardEntry together with its key,
+// used by operations that fan out across shards (e.g. ListPrefix).
+type Entry struct {
+	Key         string  `json:"key"`
+	Value       any     `json:"value"`
+	Timestamp   int64   `json:"timestamp"`
+	Ttl         float64 `json:"ttl"`
+	ModifyIndex uint64  `json:"modify_index"`
+}
+
+// DefaultPrefixLimit bounds the number of entries ListPrefix/DeletePrefix will
+// collect or delete when the caller does not supply an explicit limit, so a
+// broad prefix cannot trigger an unbounded in-memory scan.
+const DefaultPrefixLimit int = 10000
+
+func NewShardEntry(value any, ttl float64, modifyIndex uint64) *ShardEntry {
 	ts := time.Now().UnixMilli()
 	return &ShardEntry{
-		Value:     value,
-		Timestamp: ts,
-		Ttl:       ttl,
+		Value:       value,
+		Timestamp:   ts,
+		Ttl:         ttl,
+		ModifyIndex: modifyIndex,
 	}
 }
 
@@ -81,7 +113,7 @@ func NewShardWithData(data map[string]*ShardEntry) *Shard {
 }
 
 func NewKVStore(numShards int, directory string) *KVStore {
-	c := &KVStore{Shards: make([]*Shard, 0, numShards), Directory: directory, shardDimensions: make(map[int]int)}
+	c := &KVStore{Shards: make([]*Shard, 0, numShards), Directory: directory, shardDimensions: make(map[int]int), logger: logrus.New(), sessions: NewSessionStore(numShards), backend: NewFileBackend(directory)}
 	for i := range numShards {
 		c.Shards = append(c.Shards, NewShard())
 		c.shardDimensions[i] = 0
@@ -89,36 +121,82 @@ func NewKVStore(numShards int, directory string) *KVStore {
 	return c
 }
 
-func NewKVStoreFromDisk(numShards int, directory string) (*KVStore, error) {
-	c := &KVStore{Shards: make([]*Shard, 0, numShards), Directory: directory, shardDimensions: make(map[int]int)}
-	for i := range numShards {
-		fileName := path.Join(directory, fmt.Sprintf("shard-%d", i))
-		if _, err := os.Stat(fileName); errors.Is(err, os.ErrNotExist) {
-			fmt.Printf("File associated with shard %d does not exist, creating a new empty shard\n", i)
-			c.Shards = append(c.Shards, NewShard())
-			c.shardDimensions[i] = 0
-			continue
-		}
-		bData, err := os.ReadFile(fileName)
+// SetLogger replaces the store's logger, e.g. with one built via
+// logging.New from the process's CLI flags. Stores default to a plain
+// logrus.Logger until this is called.
+func (kv *KVStore) SetLogger(logger *logrus.Logger) {
+	kv.logger = logger
+}
+
+// SetBackend replaces the store's persistence backend, e.g. swapping the
+// default FileBackend for a BoltBackend or MemoryBackend. It only affects
+// future ToDisk calls; it does not migrate data already persisted through
+// the previous backend.
+func (kv *KVStore) SetBackend(backend Backend) {
+	kv.backend = backend
+}
+
+// SetWAL attaches a write-ahead log so that, from this point on, Put and
+// Delete append their mutation to wal before applying it in memory, and
+// ToDisk truncates each shard's segment once that shard has been durably
+// persisted. This closes the durability gap between periodic ToDisk
+// flushes; a store without a WAL (the default) loses anything written
+// since its last flush if it crashes. Use ReplayWAL first if wal already
+// holds entries from a previous run that should be applied on top of the
+// store's current contents.
+func (kv *KVStore) SetWAL(wal *WAL) {
+	kv.wal = wal
+}
+
+// ReplayWAL applies every entry currently in wal's segments directly to
+// kv's in-memory shards, then calls SetWAL so future mutations keep
+// appending to it. It is meant to run once at startup, right after the
+// store's snapshot has been loaded (e.g. via NewKVStoreFromBackend) and
+// before the store serves any traffic, so it mutates kv.Shards directly
+// rather than going through the shard locks Put/Delete use.
+func (kv *KVStore) ReplayWAL(wal *WAL) error {
+	for i := range kv.Shards {
+		entries, err := wal.Load(i)
 		if err != nil {
-			return nil, NewUnloadableShardError(i, err.Error())
+			return err
+		}
+		for _, entry := range entries {
+			switch entry.Op {
+			case walOpPut:
+				kv.Shards[i].Data[entry.Key] = &ShardEntry{Value: entry.Value, Timestamp: entry.Timestamp, Ttl: entry.Ttl, ModifyIndex: entry.ModifyIndex}
+			case walOpDelete:
+				delete(kv.Shards[i].Data, entry.Key)
+			}
 		}
-		bDataS := string(bData)
-		lines := strings.Split(bDataS, "\n")
-		integrityHashS := lines[len(lines)-1]
-		integrityHash, err := hex.DecodeString(integrityHashS)
+		kv.shardDimensions[i] = len(kv.Shards[i].Data)
+	}
+	kv.wal = wal
+	return nil
+}
+
+// NewKVStoreFromDisk builds a KVStore whose initial contents are loaded from
+// the per-shard files in directory, via the default FileBackend. Use
+// NewKVStoreFromBackend to load from a different Backend instead.
+func NewKVStoreFromDisk(numShards int, directory string) (*KVStore, error) {
+	return NewKVStoreFromBackend(numShards, directory, NewFileBackend(directory))
+}
+
+// NewKVStoreFromBackend builds a KVStore whose initial contents are loaded
+// from backend, one shard at a time, and whose subsequent ToDisk calls
+// persist through the same backend.
+func NewKVStoreFromBackend(numShards int, directory string, backend Backend) (*KVStore, error) {
+	c := &KVStore{Shards: make([]*Shard, 0, numShards), Directory: directory, shardDimensions: make(map[int]int), logger: logrus.New(), sessions: NewSessionStore(numShards), backend: backend}
+	for i := range numShards {
+		entries, err := backend.LoadShard(i)
 		if err != nil {
-			return nil, NewUnloadableShardError(i, err.Error())
+			return nil, err
 		}
-		mapData := []byte(strings.Join(lines[:len(lines)-1], "\n"))
-		actualHash := md5.Sum(mapData)
-		if !slices.Equal(actualHash[:], integrityHash) {
-			return nil, NewUnloadableShardError(i, "the computed hash does not match the integrity hash reported in the file")
+		if len(entries) == 0 {
+			c.logger.WithField("shard", i).Info("shard has no persisted data, creating a new empty shard")
 		}
-		var data map[string]*ShardEntry
-		err = json.Unmarshal(mapData, &data)
-		if err != nil {
-			return nil, NewUnloadableShardError(i, err.Error())
+		data := make(map[string]*ShardEntry, len(entries))
+		for key, entry := range entries {
+			data[key] = &ShardEntry{Value: entry.Value, Timestamp: entry.Timestamp, Ttl: entry.Ttl, ModifyIndex: entry.ModifyIndex}
 		}
 		c.shardDimensions[i] = len(data)
 		c.Shards = append(c.Shards, NewShardWithData(data))
@@ -126,6 +204,29 @@ func NewKVStoreFromDisk(numShards int, directory string) (*KVStore, error) {
 	return c, nil
 }
 
+// ReloadFromBackend replaces kv's in-memory contents, shard by shard, with
+// whatever is currently persisted in its backend. Unlike
+// NewKVStoreFromBackend it mutates an existing store in place rather than
+// constructing a new one, so callers that already hold a *KVStore (e.g. a
+// cluster node restoring a Raft snapshot) keep a valid reference throughout.
+func (kv *KVStore) ReloadFromBackend() error {
+	for i := range kv.Shards {
+		entries, err := kv.backend.LoadShard(i)
+		if err != nil {
+			return err
+		}
+		data := make(map[string]*ShardEntry, len(entries))
+		for key, entry := range entries {
+			data[key] = &ShardEntry{Value: entry.Value, Timestamp: entry.Timestamp, Ttl: entry.Ttl, ModifyIndex: entry.ModifyIndex}
+		}
+		kv.Shards[i].mu.Lock()
+		kv.Shards[i].Data = data
+		kv.Shards[i].mu.Unlock()
+		kv.shardDimensions[i] = len(data)
+	}
+	return nil
+}
+
 func NewKeyNotFoundError(key string) KeyNotFoundError {
 	return KeyNotFoundError{key: key}
 }
@@ -138,34 +239,47 @@ func NewUnloadableShardError(shardNum int, errorType string) UnloadableShardErro
 	return UnloadableShardError{shardNum: shardNum, errorType: errorType}
 }
 
-func (s *Shard) Evict() {
+func NewCASMismatchError(key string, expected uint64) CASMismatchError {
+	return CASMismatchError{key: key, expected: expected}
+}
+
+// Evict removes every expired entry from the shard, logging each eviction
+// at DEBUG under logger.
+func (s *Shard) Evict(shardIdx int, logger *logrus.Logger) int {
 	currentTime := time.Now().UnixMilli()
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	if len(s.Data) == 0 {
-		return
+		return 0
 	}
+	evicted := 0
 	for key, value := range s.Data {
 		if value.Ttl > 0 && float64(currentTime-value.Timestamp) > value.Ttl {
 			delete(s.Data, key)
+			metrics.CleanupEvictionsTotal.Inc()
+			evicted++
+			logger.WithFields(logrus.Fields{
+				"shard":    shardIdx,
+				"key_hash": hashKey(key),
+				"op":       "evict",
+				"result":   "ok",
+			}).Debug("evict")
 		}
 	}
+	metrics.ShardEntries.WithLabelValues(strconv.Itoa(shardIdx)).Set(float64(len(s.Data)))
+	return evicted
 }
 
-func (s *Shard) Flush(fileName string) error {
+// snapshot returns a flattened, point-in-time copy of the shard's data
+// suitable for handing to a Backend's PersistShard.
+func (s *Shard) snapshot() map[string]Entry {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	if len(s.Data) == 0 {
-		return nil
-	}
-	data, err := json.Marshal(s.Data)
-	if err != nil {
-		return err
+	data := make(map[string]Entry, len(s.Data))
+	for key, entry := range s.Data {
+		data[key] = Entry{Key: key, Value: entry.Value, Timestamp: entry.Timestamp, Ttl: entry.Ttl, ModifyIndex: entry.ModifyIndex}
 	}
-	hash := md5.Sum(data)
-	encoded := hex.EncodeToString(hash[:])
-	toWrite := append(data, append([]byte("\n"), []byte(encoded)...)...)
-	return os.WriteFile(fileName, toWrite, 0644)
+	return data
 }
 
 func (s *Shard) getLength() int {
@@ -174,66 +288,503 @@ func (s *Shard) getLength() int {
 	return len(s.Data)
 }
 
+// lockCtx acquires mu for writing, but gives up as soon as ctx is done
+// instead of blocking indefinitely on a contended shard. If ctx wins the
+// race, the lock is still claimed (and immediately released) in the
+// background once it becomes available, so a late-arriving lock never sits
+// unreleased.
+func lockCtx(ctx context.Context, mu *sync.RWMutex) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	acquired := make(chan struct{})
+	go func() {
+		mu.Lock()
+		close(acquired)
+	}()
+	select {
+	case <-acquired:
+		return nil
+	case <-ctx.Done():
+		go func() {
+			<-acquired
+			mu.Unlock()
+		}()
+		return ctx.Err()
+	}
+}
+
+// rlockCtx is lockCtx for a read lock.
+func rlockCtx(ctx context.Context, mu *sync.RWMutex) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	acquired := make(chan struct{})
+	go func() {
+		mu.RLock()
+		close(acquired)
+	}()
+	select {
+	case <-acquired:
+		return nil
+	case <-ctx.Done():
+		go func() {
+			<-acquired
+			mu.RUnlock()
+		}()
+		return ctx.Err()
+	}
+}
+
 func (kv *KVStore) findShard(key string) int {
 	hash := crc32.ChecksumIEEE([]byte(key))
 	return int(hash) % len(kv.Shards)
 }
 
-func (kv *KVStore) Put(key string, value any, ttl *float64) {
-	var actualTtl float64
-	switch ttl {
-	case nil:
-		actualTtl = -1
-	default:
-		actualTtl = *ttl * 1000
+// isExpired reports whether entry has a positive TTL that has elapsed as of
+// currentTime, i.e. whether it should be treated as if it were absent.
+func isExpired(entry *ShardEntry, currentTime int64) bool {
+	return entry.Ttl > 0 && float64(currentTime-entry.Timestamp) > entry.Ttl
+}
+
+func actualTtlFrom(ttl *float64) float64 {
+	if ttl == nil {
+		return -1
 	}
+	return *ttl * 1000
+}
+
+// hashKey fingerprints key for log fields, so access logs can be joined
+// across requests for the same key without ever logging the key itself.
+func hashKey(key string) string {
+	return fmt.Sprintf("%08x", crc32.ChecksumIEEE([]byte(key)))
+}
+
+// Put stores value under key, honoring ctx while waiting for the shard's
+// write lock: if ctx is cancelled (or its deadline passes) before the lock
+// is acquired, Put gives up and returns ctx.Err() instead of blocking
+// indefinitely behind a contended shard.
+func (kv *KVStore) Put(ctx context.Context, key string, value any, ttl *float64) (uint64, error) {
+	start := time.Now()
+	actualTtl := actualTtlFrom(ttl)
 	shardIdx := kv.findShard(key)
-	kv.Shards[shardIdx].mu.Lock()
+	if err := lockCtx(ctx, &kv.Shards[shardIdx].mu); err != nil {
+		return 0, err
+	}
 	defer kv.Shards[shardIdx].mu.Unlock()
-	kv.Shards[shardIdx].Data[key] = NewShardEntry(value, actualTtl)
+	var nextIndex uint64 = 1
+	if existing, ok := kv.Shards[shardIdx].Data[key]; ok {
+		nextIndex = existing.ModifyIndex + 1
+	}
+	entry := NewShardEntry(value, actualTtl, nextIndex)
+	if kv.wal != nil {
+		walErr := kv.wal.Append(shardIdx, walEntry{Op: walOpPut, Key: key, Value: value, Timestamp: entry.Timestamp, Ttl: actualTtl, ModifyIndex: nextIndex})
+		if walErr != nil {
+			return 0, walErr
+		}
+	}
+	kv.Shards[shardIdx].Data[key] = entry
+	metrics.ShardEntries.WithLabelValues(strconv.Itoa(shardIdx)).Set(float64(len(kv.Shards[shardIdx].Data)))
+	metrics.KVOpsTotal.WithLabelValues("put", "ok").Inc()
+	metrics.KVOpDuration.WithLabelValues("put").Observe(time.Since(start).Seconds())
+	kv.logger.WithFields(logrus.Fields{
+		"shard":       shardIdx,
+		"key_hash":    hashKey(key),
+		"op":          "put",
+		"ttl_ms":      actualTtl,
+		"duration_ms": float64(time.Since(start)) / float64(time.Millisecond),
+		"result":      "ok",
+	}).Debug("put")
+	return nextIndex, nil
 }
 
-func (kv *KVStore) Get(key string) (any, error) {
+// Get reads key, honoring ctx while waiting for the shard's read lock: if
+// ctx is cancelled before the lock is acquired, Get gives up and returns
+// ctx.Err() instead of blocking indefinitely behind a contended shard.
+func (kv *KVStore) Get(ctx context.Context, key string) (any, uint64, error) {
+	start := time.Now()
 	currentTime := time.Now().UnixMilli()
 	shardIdx := kv.findShard(key)
-	kv.Shards[shardIdx].mu.RLock()
+	if err := rlockCtx(ctx, &kv.Shards[shardIdx].mu); err != nil {
+		return nil, 0, err
+	}
 	defer kv.Shards[shardIdx].mu.RUnlock()
+	result := "miss"
+	defer func() {
+		metrics.KVOpsTotal.WithLabelValues("get", result).Inc()
+		metrics.KVOpDuration.WithLabelValues("get").Observe(time.Since(start).Seconds())
+		kv.logger.WithFields(logrus.Fields{
+			"shard":       shardIdx,
+			"key_hash":    hashKey(key),
+			"op":          "get",
+			"duration_ms": float64(time.Since(start)) / float64(time.Millisecond),
+			"result":      result,
+		}).Debug("get")
+	}()
 	val, ok := kv.Shards[shardIdx].Data[key]
 	if ok {
-		if val.Ttl > 0 && float64(currentTime-val.Timestamp) > val.Ttl {
-			return nil, NewExpiredEntryError(key, val.Ttl, (currentTime - val.Timestamp))
+		if isExpired(val, currentTime) {
+			result = "expired"
+			return nil, 0, NewExpiredEntryError(key, val.Ttl, (currentTime - val.Timestamp))
 		}
-		return val.Value, nil
+		result = "hit"
+		return val.Value, val.ModifyIndex, nil
 	}
-	return nil, NewKeyNotFoundError(key)
+	return nil, 0, NewKeyNotFoundError(key)
 }
 
-func (kv *KVStore) Delete(key string) {
+// Delete removes key, honoring ctx while waiting for the shard's write
+// lock, the same way Put does.
+func (kv *KVStore) Delete(ctx context.Context, key string) error {
+	start := time.Now()
+	shardIdx := kv.findShard(key)
+	if err := lockCtx(ctx, &kv.Shards[shardIdx].mu); err != nil {
+		return err
+	}
+	defer kv.Shards[shardIdx].mu.Unlock()
+	if kv.wal != nil {
+		if err := kv.wal.Append(shardIdx, walEntry{Op: walOpDelete, Key: key}); err != nil {
+			return err
+		}
+	}
+	delete(kv.Shards[shardIdx].Data, key)
+	metrics.ShardEntries.WithLabelValues(strconv.Itoa(shardIdx)).Set(float64(len(kv.Shards[shardIdx].Data)))
+	metrics.KVOpsTotal.WithLabelValues("delete", "ok").Inc()
+	metrics.KVOpDuration.WithLabelValues("delete").Observe(time.Since(start).Seconds())
+	kv.logger.WithFields(logrus.Fields{
+		"shard":       shardIdx,
+		"key_hash":    hashKey(key),
+		"op":          "delete",
+		"duration_ms": float64(time.Since(start)) / float64(time.Millisecond),
+		"result":      "ok",
+	}).Debug("delete")
+	return nil
+}
+
+// CompareAndSwap applies value/ttl to key only if the current state matches
+// cas: either cas is 0 and the key is absent (or expired), or cas equals the
+// stored ModifyIndex. The check and the write happen under the same shard
+// write lock so concurrent writers race-safely. It reports the new
+// ModifyIndex and whether the write was applied.
+func (kv *KVStore) CompareAndSwap(key string, value any, ttl *float64, cas uint64) (uint64, bool, error) {
+	currentTime := time.Now().UnixMilli()
 	shardIdx := kv.findShard(key)
 	kv.Shards[shardIdx].mu.Lock()
 	defer kv.Shards[shardIdx].mu.Unlock()
+	existing, ok := kv.Shards[shardIdx].Data[key]
+	live := ok && !isExpired(existing, currentTime)
+	if cas == 0 {
+		if live {
+			return existing.ModifyIndex, false, NewCASMismatchError(key, cas)
+		}
+		entry := NewShardEntry(value, actualTtlFrom(ttl), 1)
+		if kv.wal != nil {
+			if err := kv.wal.Append(shardIdx, walEntry{Op: walOpPut, Key: key, Value: value, Timestamp: entry.Timestamp, Ttl: entry.Ttl, ModifyIndex: entry.ModifyIndex}); err != nil {
+				return 0, false, err
+			}
+		}
+		kv.Shards[shardIdx].Data[key] = entry
+		return entry.ModifyIndex, true, nil
+	}
+	if !live || existing.ModifyIndex != cas {
+		var currentIndex uint64
+		if live {
+			currentIndex = existing.ModifyIndex
+		}
+		return currentIndex, false, NewCASMismatchError(key, cas)
+	}
+	entry := NewShardEntry(value, actualTtlFrom(ttl), existing.ModifyIndex+1)
+	if kv.wal != nil {
+		if err := kv.wal.Append(shardIdx, walEntry{Op: walOpPut, Key: key, Value: value, Timestamp: entry.Timestamp, Ttl: entry.Ttl, ModifyIndex: entry.ModifyIndex}); err != nil {
+			return 0, false, err
+		}
+	}
+	kv.Shards[shardIdx].Data[key] = entry
+	return entry.ModifyIndex, true, nil
+}
+
+// CompareAndDelete removes key only if the current state matches cas: either
+// cas is 0 (an unconditional delete, mirroring Delete), or cas equals the
+// stored ModifyIndex. It reports whether the key was removed.
+func (kv *KVStore) CompareAndDelete(key string, cas uint64) (bool, error) {
+	currentTime := time.Now().UnixMilli()
+	shardIdx := kv.findShard(key)
+	kv.Shards[shardIdx].mu.Lock()
+	defer kv.Shards[shardIdx].mu.Unlock()
+	if cas == 0 {
+		if kv.wal != nil {
+			if err := kv.wal.Append(shardIdx, walEntry{Op: walOpDelete, Key: key}); err != nil {
+				return false, err
+			}
+		}
+		delete(kv.Shards[shardIdx].Data, key)
+		return true, nil
+	}
+	existing, ok := kv.Shards[shardIdx].Data[key]
+	if !ok || isExpired(existing, currentTime) || existing.ModifyIndex != cas {
+		return false, NewCASMismatchError(key, cas)
+	}
+	if kv.wal != nil {
+		if err := kv.wal.Append(shardIdx, walEntry{Op: walOpDelete, Key: key}); err != nil {
+			return false, err
+		}
+	}
 	delete(kv.Shards[shardIdx].Data, key)
+	return true, nil
+}
+
+// ListPrefix fans out across every shard and collects the entries whose key
+// starts with prefix, stopping once limit entries have been gathered. A
+// limit <= 0 falls back to DefaultPrefixLimit so a broad prefix cannot
+// trigger an unbounded in-memory scan.
+func (kv *KVStore) ListPrefix(prefix string, limit int) ([]Entry, error) {
+	if limit <= 0 {
+		limit = DefaultPrefixLimit
+	}
+	currentTime := time.Now().UnixMilli()
+	entries := make([]Entry, 0, limit)
+	for _, shard := range kv.Shards {
+		shard.mu.RLock()
+		for key, value := range shard.Data {
+			if len(entries) >= limit {
+				shard.mu.RUnlock()
+				return entries, nil
+			}
+			if !strings.HasPrefix(key, prefix) {
+				continue
+			}
+			if isExpired(value, currentTime) {
+				continue
+			}
+			entries = append(entries, Entry{Key: key, Value: value.Value, Timestamp: value.Timestamp, Ttl: value.Ttl, ModifyIndex: value.ModifyIndex})
+		}
+		shard.mu.RUnlock()
+	}
+	return entries, nil
+}
+
+// DeletePrefix fans out across every shard and removes, under each shard's
+// write lock, every key starting with prefix, stopping once limit keys have
+// been removed. It returns the number of keys actually deleted. A limit <= 0
+// falls back to DefaultPrefixLimit so a broad prefix cannot trigger an
+// unbounded scan.
+func (kv *KVStore) DeletePrefix(prefix string, limit int) (int, error) {
+	if limit <= 0 {
+		limit = DefaultPrefixLimit
+	}
+	deleted := 0
+	for shardIdx, shard := range kv.Shards {
+		if deleted >= limit {
+			break
+		}
+		shard.mu.Lock()
+		for key := range shard.Data {
+			if deleted >= limit {
+				break
+			}
+			if !strings.HasPrefix(key, prefix) {
+				continue
+			}
+			if kv.wal != nil {
+				if err := kv.wal.Append(shardIdx, walEntry{Op: walOpDelete, Key: key}); err != nil {
+					shard.mu.Unlock()
+					return deleted, err
+				}
+			}
+			delete(shard.Data, key)
+			deleted++
+		}
+		shard.mu.Unlock()
+	}
+	return deleted, nil
 }
 
-func (kv *KVStore) Cleanup() {
+// TxnOp is a single operation within a Transaction. Verb is one of "get",
+// "set", "delete" or "cas"; Value and Ttl are used by "set" and "cas", and
+// CAS is required by "cas" (0 meaning "create only if absent", matching
+// CompareAndSwap).
+type TxnOp struct {
+	Verb  string   `json:"verb"`
+	Key   string   `json:"key"`
+	Value any      `json:"value,omitempty"`
+	Ttl   *float64 `json:"ttl,omitempty"`
+	CAS   *uint64  `json:"cas,omitempty"`
+}
+
+// TxnResult is the outcome of a single TxnOp within a Transaction.
+type TxnResult struct {
+	Key         string `json:"key"`
+	Value       any    `json:"value,omitempty"`
+	ModifyIndex uint64 `json:"modify_index,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+// Transaction applies ops atomically: every op's verb is checked and every
+// "cas" precondition is validated before any op is applied, so either all
+// ops take effect or none do. Ops are grouped by shard and the shard write
+// locks are acquired in ascending shard-index order (regardless of the
+// order keys appear in ops), so concurrent transactions can never deadlock
+// against each other. It returns a result per op (in the same order as ops)
+// and a non-nil error if any op has an unrecognized verb or any "cas"
+// precondition failed, in which case no op was applied.
+func (kv *KVStore) Transaction(ops []TxnOp) ([]TxnResult, error) {
+	currentTime := time.Now().UnixMilli()
+	results := make([]TxnResult, len(ops))
+
+	shardIdxSet := make(map[int]bool)
+	for _, op := range ops {
+		shardIdxSet[kv.findShard(op.Key)] = true
+	}
+	shardIdxs := make([]int, 0, len(shardIdxSet))
+	for idx := range shardIdxSet {
+		shardIdxs = append(shardIdxs, idx)
+	}
+	sort.Ints(shardIdxs)
+
+	for _, idx := range shardIdxs {
+		kv.Shards[idx].mu.Lock()
+	}
+	defer func() {
+		for _, idx := range shardIdxs {
+			kv.Shards[idx].mu.Unlock()
+		}
+	}()
+
+	aborted := false
+	for i, op := range ops {
+		if op.Verb != "get" && op.Verb != "set" && op.Verb != "cas" && op.Verb != "delete" {
+			results[i] = TxnResult{Key: op.Key, Error: fmt.Sprintf("unknown txn verb %q", op.Verb)}
+			aborted = true
+			continue
+		}
+		if op.Verb != "cas" {
+			continue
+		}
+		shardIdx := kv.findShard(op.Key)
+		var cas uint64
+		if op.CAS != nil {
+			cas = *op.CAS
+		}
+		existing, ok := kv.Shards[shardIdx].Data[op.Key]
+		live := ok && !isExpired(existing, currentTime)
+		if cas == 0 {
+			if live {
+				results[i] = TxnResult{Key: op.Key, Error: NewCASMismatchError(op.Key, cas).Error()}
+				aborted = true
+			}
+			continue
+		}
+		if !live || existing.ModifyIndex != cas {
+			results[i] = TxnResult{Key: op.Key, Error: NewCASMismatchError(op.Key, cas).Error()}
+			aborted = true
+		}
+	}
+	if aborted {
+		return results, errors.New("transaction aborted: one or more ops had an unrecognized verb or failed its CAS precondition")
+	}
+
+	// Each mutating op is appended to the WAL right before it is applied in
+	// memory, the same order Put/Delete use, so a crash partway through a
+	// transaction never leaves the WAL missing a mutation the in-memory
+	// shards already reflect.
+	for i, op := range ops {
+		shardIdx := kv.findShard(op.Key)
+		shard := kv.Shards[shardIdx]
+		switch op.Verb {
+		case "get":
+			existing, ok := shard.Data[op.Key]
+			if !ok || isExpired(existing, currentTime) {
+				results[i] = TxnResult{Key: op.Key, Error: NewKeyNotFoundError(op.Key).Error()}
+				continue
+			}
+			results[i] = TxnResult{Key: op.Key, Value: existing.Value, ModifyIndex: existing.ModifyIndex}
+		case "set", "cas":
+			var nextIndex uint64 = 1
+			if existing, ok := shard.Data[op.Key]; ok {
+				nextIndex = existing.ModifyIndex + 1
+			}
+			entry := NewShardEntry(op.Value, actualTtlFrom(op.Ttl), nextIndex)
+			if kv.wal != nil {
+				if err := kv.wal.Append(shardIdx, walEntry{Op: walOpPut, Key: op.Key, Value: op.Value, Timestamp: entry.Timestamp, Ttl: entry.Ttl, ModifyIndex: entry.ModifyIndex}); err != nil {
+					return results, err
+				}
+			}
+			shard.Data[op.Key] = entry
+			results[i] = TxnResult{Key: op.Key, ModifyIndex: nextIndex}
+		case "delete":
+			if kv.wal != nil {
+				if err := kv.wal.Append(shardIdx, walEntry{Op: walOpDelete, Key: op.Key}); err != nil {
+					return results, err
+				}
+			}
+			delete(shard.Data, op.Key)
+			results[i] = TxnResult{Key: op.Key}
+		}
+	}
+
+	for _, idx := range shardIdxs {
+		metrics.ShardEntries.WithLabelValues(strconv.Itoa(idx)).Set(float64(len(kv.Shards[idx].Data)))
+	}
+	metrics.KVOpsTotal.WithLabelValues("txn", "ok").Inc()
+	kv.logger.WithFields(logrus.Fields{
+		"ops":    len(ops),
+		"shards": len(shardIdxs),
+	}).Debug("transaction")
+
+	return results, nil
+}
+
+// Cleanup evicts expired entries from every shard, checking ctx between
+// shards so a cancelled caller does not pay for shards it no longer needs
+// evicted.
+func (kv *KVStore) Cleanup(ctx context.Context) error {
+	start := time.Now()
+	evicted := 0
 	for i := range kv.Shards {
-		kv.Shards[i].Evict()
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		evicted += kv.Shards[i].Evict(i, kv.logger)
 	}
+	kv.logger.WithFields(logrus.Fields{
+		"shards":      len(kv.Shards),
+		"evicted":     evicted,
+		"duration_ms": float64(time.Since(start)) / float64(time.Millisecond),
+	}).Info("cleanup")
+	return nil
 }
 
-func (kv *KVStore) ToDisk() error {
+// ToDisk persists every shard whose number of entries has changed since the
+// last call through kv.backend, which defaults to a FileBackend rooted at
+// kv.Directory but can be swapped with SetBackend (e.g. for a BoltBackend or
+// MemoryBackend). A shard whose values were overwritten without its entry
+// count changing is not persisted (and its WAL segment is kept). It
+// checks ctx between shards, so a cancelled caller (e.g. a disconnected
+// client behind an HTTP-triggered flush) aborts the remaining shards instead
+// of writing them all out regardless.
+func (kv *KVStore) ToDisk(ctx context.Context) error {
 	for i := range kv.Shards {
-		fileName := path.Join(kv.Directory, fmt.Sprintf("shard-%d", i))
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		shardLength := kv.Shards[i].getLength()
 		if kv.shardDimensions[i] == shardLength {
 			// no new content, keep as-is
 			continue
 		}
 		kv.shardDimensions[i] = shardLength
-		err := kv.Shards[i].Flush(fileName)
+		start := time.Now()
+		err := kv.backend.PersistShard(i, kv.Shards[i].snapshot())
+		metrics.ShardFlushDuration.WithLabelValues(strconv.Itoa(i)).Observe(time.Since(start).Seconds())
 		if err != nil {
+			metrics.FlushErrorsTotal.Inc()
 			return err
 		}
+		if kv.wal != nil {
+			if err := kv.wal.Truncate(i); err != nil {
+				return err
+			}
+		}
 	}
 	return nil
 }
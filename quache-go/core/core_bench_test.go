@@ -1,6 +1,9 @@
 package core
 
-import "testing"
+import (
+	"context"
+	"testing"
+)
 
 func BenchmarkPutGetDelete1Shard(b *testing.B) {
 	kvStore := NewKVStore(1, TestDirectory)
@@ -8,9 +11,9 @@ func BenchmarkPutGetDelete1Shard(b *testing.B) {
 	value := 1
 	b.ResetTimer()
 	for b.Loop() {
-		kvStore.Put(key, value, nil)
-		kvStore.Get(key)
-		kvStore.Delete(key)
+		kvStore.Put(context.Background(), key, value, nil)
+		kvStore.Get(context.Background(), key)
+		kvStore.Delete(context.Background(), key)
 	}
 }
 
@@ -20,9 +23,9 @@ func BenchmarkPutGetDelete10Shards(b *testing.B) {
 	value := 1
 	b.ResetTimer()
 	for b.Loop() {
-		kvStore.Put(key, value, nil)
-		kvStore.Get(key)
-		kvStore.Delete(key)
+		kvStore.Put(context.Background(), key, value, nil)
+		kvStore.Get(context.Background(), key)
+		kvStore.Delete(context.Background(), key)
 	}
 }
 
@@ -32,8 +35,8 @@ func BenchmarkPutGetDelete100Shards(b *testing.B) {
 	value := 1
 	b.ResetTimer()
 	for b.Loop() {
-		kvStore.Put(key, value, nil)
-		kvStore.Get(key)
-		kvStore.Delete(key)
+		kvStore.Put(context.Background(), key, value, nil)
+		kvStore.Get(context.Background(), key)
+		kvStore.Delete(context.Background(), key)
 	}
 }
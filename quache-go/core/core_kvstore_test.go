@@ -1,6 +1,7 @@
 package core
 
 import (
+	"context"
 	"errors"
 	"os"
 	"path"
@@ -49,85 +50,276 @@ func TestFindShard(t *testing.T) {
 
 func TestPut(t *testing.T) {
 	store := NewKVStore(3, TestDirectory)
-	store.Put("thisisaverylongkey", 1, nil)
+	store.Put(context.Background(), "thisisaverylongkey", 1, nil)
 	assert.Equal(t, store.Shards[1].getLength(), 1, "The first shard should have a dimension of 1")
-	store.Put("notthekindofthingyouwouldfind", 2, nil)
+	store.Put(context.Background(), "notthekindofthingyouwouldfind", 2, nil)
 	assert.Equal(t, store.Shards[0].getLength(), 1, "The 0-th shard should have a dimension of 1")
-	store.Put("this is an interesting key", 3, nil)
+	store.Put(context.Background(), "this is an interesting key", 3, nil)
 	assert.Equal(t, store.Shards[2].getLength(), 1, "The second shard should have a dimension of 1")
-	store.Put("thisisaverylongkey", 2, nil)
+	store.Put(context.Background(), "thisisaverylongkey", 2, nil)
 	assert.Equal(t, store.Shards[1].getLength(), 1, "The first shard should still have a dimension of 1 (updated not appended)")
-	store.Put("hey", 4, nil) // hey should be routed to the 2nd shard
+	store.Put(context.Background(), "hey", 4, nil) // hey should be routed to the 2nd shard
 	assert.Equal(t, store.Shards[2].getLength(), 2, "The second shard should have a dimension of 2")
 }
 
 func TestGet(t *testing.T) {
 	store := NewKVStore(3, TestDirectory)
 	var ttl float64 = 0.001 // one millisecond
-	store.Put("hello", 1, nil)
-	store.Put("bye", 2, &ttl)
+	store.Put(context.Background(), "hello", 1, nil)
+	store.Put(context.Background(), "bye", 2, &ttl)
 	time.Sleep(3 * time.Millisecond)
-	val, err := store.Get("hello")
+	val, modifyIndex, err := store.Get(context.Background(), "hello")
 	assert.Nil(t, err, "Should be able to retrieve the 'hello' key")
 	assert.Equal(t, val, 1, "Value should be equal to 1")
-	_, err = store.Get("bye")
+	assert.Equal(t, modifyIndex, uint64(1), "Modify index should be 1 after a single Put")
+	_, _, err = store.Get(context.Background(), "bye")
 	assert.NotNil(t, err, "Error should be non-nil when retrieving 'bye' past-ttl")
 	assert.Contains(t, err.Error(), "is expired")
-	_, err = store.Get("nonexisting")
+	_, _, err = store.Get(context.Background(), "nonexisting")
 	assert.NotNil(t, err, "Error should be non-nil when retrieving a non-existing key")
 	assert.Contains(t, err.Error(), "not found")
 }
 
 func TestDelete(t *testing.T) {
 	store := NewKVStore(3, TestDirectory)
-	store.Put("hello", 1, nil)
-	store.Delete("hello")
-	_, err := store.Get("hello")
+	store.Put(context.Background(), "hello", 1, nil)
+	store.Delete(context.Background(), "hello")
+	_, _, err := store.Get(context.Background(), "hello")
 	assert.NotNil(t, err, "Error should be non-nil when retrieving a deleted key")
 	assert.Contains(t, err.Error(), "not found")
-	store.Delete("bye") // does not panic when Delete is called on a non-existing key
+	store.Delete(context.Background(), "bye") // does not panic when Delete is called on a non-existing key
+}
+
+func TestPutRespectsCancelledContext(t *testing.T) {
+	store := NewKVStore(3, TestDirectory)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := store.Put(ctx, "hello", 1, nil)
+	assert.ErrorIs(t, err, context.Canceled, "Put should abort immediately when ctx is already cancelled")
+}
+
+func TestGetRespectsCancelledContext(t *testing.T) {
+	store := NewKVStore(3, TestDirectory)
+	store.Put(context.Background(), "hello", 1, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, _, err := store.Get(ctx, "hello")
+	assert.ErrorIs(t, err, context.Canceled, "Get should abort immediately when ctx is already cancelled")
 }
 
 func TestCleanup(t *testing.T) {
 	store := NewKVStore(3, TestDirectory)
-	ttl := 0.001                                       // 1 millisecond
-	var ttl1 float64 = 1                               // 1 second
-	store.Put("notthekindofthingyouwouldfind", 1, nil) // 0-th shard
-	store.Put("thisisaverylongkey", 2, &ttl)           // 1st shard
-	store.Put("this is an interesting key", 3, &ttl1)  // 2nd shard
-	store.Put("hey", 4, &ttl)                          // 2nd shard
+	ttl := 0.001                                                             // 1 millisecond
+	var ttl1 float64 = 1                                                     // 1 second
+	store.Put(context.Background(), "notthekindofthingyouwouldfind", 1, nil) // 0-th shard
+	store.Put(context.Background(), "thisisaverylongkey", 2, &ttl)           // 1st shard
+	store.Put(context.Background(), "this is an interesting key", 3, &ttl1)  // 2nd shard
+	store.Put(context.Background(), "hey", 4, &ttl)                          // 2nd shard
 	time.Sleep(3 * time.Millisecond)
-	store.Cleanup()
+	store.Cleanup(context.Background())
 	assert.Equal(t, store.Shards[0].getLength(), 1, "Key should have been evicted from shard 0")
 	assert.Equal(t, store.Shards[1].getLength(), 0, "Key should not have been evicted shard 1")
 	assert.Equal(t, store.Shards[2].getLength(), 1, "Only one key should remain in shard 2")
 }
 
+func TestCleanupRespectsCancelledContext(t *testing.T) {
+	store := NewKVStore(3, TestDirectory)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := store.Cleanup(ctx)
+	assert.ErrorIs(t, err, context.Canceled, "Cleanup should abort before evicting any shard when ctx is already cancelled")
+}
+
 func TestToAndFromDisk(t *testing.T) {
 	err := makeTestDirectory()
 	if err != nil {
 		t.Fatalf("An error occurred while creating the test directory: %s", err.Error())
 	}
 	store := NewKVStore(3, TestDirectory)
-	store.Put("notthekindofthingyouwouldfind", 1, nil) // 0-th shard
-	store.Put("thisisaverylongkey", 2, nil)            // 1st shard
-	store.Put("this is an interesting key", 3, nil)    // 2nd shard
-	store.Put("hey", 4, nil)                           // 2nd shard
-	err = store.ToDisk()
+	store.Put(context.Background(), "notthekindofthingyouwouldfind", 1, nil) // 0-th shard
+	store.Put(context.Background(), "thisisaverylongkey", 2, nil)            // 1st shard
+	store.Put(context.Background(), "this is an interesting key", 3, nil)    // 2nd shard
+	store.Put(context.Background(), "hey", 4, nil)                           // 2nd shard
+	err = store.ToDisk(context.Background())
 	assert.Nil(t, err, "Error should be nil when flushing to disk")
 	store1, err := NewKVStoreFromDisk(3, TestDirectory)
 	assert.Nil(t, err, "Error should be nil when loading from disk")
-	val1, err := store1.Get("notthekindofthingyouwouldfind")
+	val1, _, err := store1.Get(context.Background(), "notthekindofthingyouwouldfind")
 	assert.Nil(t, err, "Error should be nil when retrieving an existing key")
 	assert.Equal(t, val1, float64(1))
-	val2, err := store1.Get("thisisaverylongkey")
+	val2, _, err := store1.Get(context.Background(), "thisisaverylongkey")
 	assert.Nil(t, err, "Error should be nil when retrieving an existing key")
 	assert.Equal(t, val2, float64(2))
-	val3, err := store1.Get("this is an interesting key")
+	val3, _, err := store1.Get(context.Background(), "this is an interesting key")
 	assert.Nil(t, err, "Error should be nil when retrieving an existing key")
 	assert.Equal(t, val3, float64(3))
-	val4, err := store1.Get("hey")
+	val4, _, err := store1.Get(context.Background(), "hey")
 	assert.Nil(t, err, "Error should be nil when retrieving an existing key")
 	assert.Equal(t, val4, float64(4))
 	_ = cleanupTestDirectory()
 }
+
+func TestToDiskRespectsCancelledContext(t *testing.T) {
+	store := NewKVStore(3, TestDirectory)
+	store.Put(context.Background(), "hello", 1, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := store.ToDisk(ctx)
+	assert.ErrorIs(t, err, context.Canceled, "ToDisk should abort before flushing any shard when ctx is already cancelled")
+}
+
+func TestListPrefix(t *testing.T) {
+	store := NewKVStore(3, TestDirectory)
+	store.Put(context.Background(), "user:1", 1, nil)
+	store.Put(context.Background(), "user:2", 2, nil)
+	store.Put(context.Background(), "order:1", 3, nil)
+	entries, err := store.ListPrefix("user:", 0)
+	assert.Nil(t, err, "Error should be nil when listing by prefix")
+	assert.Len(t, entries, 2, "Only the two 'user:' keys should be returned")
+	keys := []string{entries[0].Key, entries[1].Key}
+	assert.ElementsMatch(t, keys, []string{"user:1", "user:2"})
+}
+
+func TestListPrefixLimit(t *testing.T) {
+	store := NewKVStore(3, TestDirectory)
+	store.Put(context.Background(), "user:1", 1, nil)
+	store.Put(context.Background(), "user:2", 2, nil)
+	store.Put(context.Background(), "user:3", 3, nil)
+	entries, err := store.ListPrefix("user:", 2)
+	assert.Nil(t, err, "Error should be nil when listing by prefix")
+	assert.Len(t, entries, 2, "Listing should stop at the provided limit")
+}
+
+func TestDeletePrefix(t *testing.T) {
+	store := NewKVStore(3, TestDirectory)
+	store.Put(context.Background(), "user:1", 1, nil)
+	store.Put(context.Background(), "user:2", 2, nil)
+	store.Put(context.Background(), "order:1", 3, nil)
+	deleted, err := store.DeletePrefix("user:", 0)
+	assert.Nil(t, err, "Error should be nil when deleting by prefix")
+	assert.Equal(t, deleted, 2, "Both 'user:' keys should have been deleted")
+	_, _, err = store.Get(context.Background(), "user:1")
+	assert.NotNil(t, err, "'user:1' should no longer exist")
+	_, _, err = store.Get(context.Background(), "order:1")
+	assert.Nil(t, err, "'order:1' should not have been touched")
+}
+
+func TestCompareAndSwapCreatesWhenAbsent(t *testing.T) {
+	store := NewKVStore(3, TestDirectory)
+	newIndex, ok, err := store.CompareAndSwap("hello", 1, nil, 0)
+	assert.Nil(t, err, "Error should be nil when creating a new key with cas=0")
+	assert.True(t, ok, "Write should be applied when the key is absent and cas=0")
+	assert.Equal(t, newIndex, uint64(1), "First write should produce modify index 1")
+}
+
+func TestCompareAndSwapRejectsCreateWhenPresent(t *testing.T) {
+	store := NewKVStore(3, TestDirectory)
+	store.Put(context.Background(), "hello", 1, nil)
+	_, ok, err := store.CompareAndSwap("hello", 2, nil, 0)
+	assert.False(t, ok, "Write should be rejected when the key already exists and cas=0")
+	assert.NotNil(t, err, "Error should be non-nil on a CAS mismatch")
+}
+
+func TestCompareAndSwapAppliesOnMatchingIndex(t *testing.T) {
+	store := NewKVStore(3, TestDirectory)
+	_, _, err := store.CompareAndSwap("hello", 1, nil, 0)
+	assert.Nil(t, err, "Error should be nil when creating a new key with cas=0")
+	newIndex, ok, err := store.CompareAndSwap("hello", 2, nil, 1)
+	assert.Nil(t, err, "Error should be nil when the cas matches the stored modify index")
+	assert.True(t, ok, "Write should be applied when cas matches the stored modify index")
+	assert.Equal(t, newIndex, uint64(2), "Modify index should be bumped to 2")
+	val, modifyIndex, err := store.Get(context.Background(), "hello")
+	assert.Nil(t, err, "Error should be nil when retrieving the key")
+	assert.Equal(t, val, 2, "Value should have been updated to 2")
+	assert.Equal(t, modifyIndex, uint64(2))
+}
+
+func TestCompareAndSwapRejectsStaleIndex(t *testing.T) {
+	store := NewKVStore(3, TestDirectory)
+	store.Put(context.Background(), "hello", 1, nil)
+	_, ok, err := store.CompareAndSwap("hello", 2, nil, 999)
+	assert.False(t, ok, "Write should be rejected when cas does not match the stored modify index")
+	assert.NotNil(t, err, "Error should be non-nil on a CAS mismatch")
+}
+
+func TestCompareAndDelete(t *testing.T) {
+	store := NewKVStore(3, TestDirectory)
+	newIndex, err := store.Put(context.Background(), "hello", 1, nil)
+	assert.Nil(t, err, "Error should be nil when putting 'hello'")
+	ok, err := store.CompareAndDelete("hello", newIndex)
+	assert.Nil(t, err, "Error should be nil when cas matches the stored modify index")
+	assert.True(t, ok, "Delete should be applied when cas matches the stored modify index")
+	_, _, err = store.Get(context.Background(), "hello")
+	assert.NotNil(t, err, "'hello' should have been deleted")
+}
+
+func TestCompareAndDeleteRejectsStaleIndex(t *testing.T) {
+	store := NewKVStore(3, TestDirectory)
+	store.Put(context.Background(), "hello", 1, nil)
+	ok, err := store.CompareAndDelete("hello", 999)
+	assert.False(t, ok, "Delete should be rejected when cas does not match the stored modify index")
+	assert.NotNil(t, err, "Error should be non-nil on a CAS mismatch")
+	_, _, err = store.Get(context.Background(), "hello")
+	assert.Nil(t, err, "'hello' should not have been deleted")
+}
+
+func TestTransactionAppliesAllOps(t *testing.T) {
+	store := NewKVStore(3, TestDirectory)
+	store.Put(context.Background(), "hello", 1, nil)
+	results, err := store.Transaction([]TxnOp{
+		{Verb: "set", Key: "bye", Value: 2},
+		{Verb: "get", Key: "hello"},
+		{Verb: "delete", Key: "hello"},
+	})
+	assert.Nil(t, err, "Error should be nil when every op succeeds")
+	assert.Len(t, results, 3)
+	assert.Equal(t, results[0].ModifyIndex, uint64(1), "'bye' should have been created with modify index 1")
+	assert.Equal(t, results[1].Value, 1, "'hello' should have been read before being deleted")
+	_, _, err = store.Get(context.Background(), "hello")
+	assert.NotNil(t, err, "'hello' should have been deleted by the transaction")
+	val, _, err := store.Get(context.Background(), "bye")
+	assert.Nil(t, err, "'bye' should have been created by the transaction")
+	assert.Equal(t, val, 2)
+}
+
+func TestTransactionAbortsAllOpsOnCASFailure(t *testing.T) {
+	store := NewKVStore(3, TestDirectory)
+	results, err := store.Transaction([]TxnOp{
+		{Verb: "set", Key: "bye", Value: 2},
+		{Verb: "cas", Key: "hello", Value: 1, CAS: uint64Ptr(999)},
+	})
+	assert.NotNil(t, err, "Error should be non-nil when a CAS precondition fails")
+	assert.NotEmpty(t, results[1].Error, "Failing op should report a CAS mismatch error")
+	_, _, err = store.Get(context.Background(), "bye")
+	assert.NotNil(t, err, "'bye' should not have been created: the whole transaction was aborted")
+}
+
+func TestTransactionAbortsAllOpsOnUnknownVerb(t *testing.T) {
+	store := NewKVStore(3, TestDirectory)
+	results, err := store.Transaction([]TxnOp{
+		{Verb: "set", Key: "bye", Value: 2},
+		{Verb: "frobnicate", Key: "hello", Value: 1},
+	})
+	assert.NotNil(t, err, "Error should be non-nil when an op has an unrecognized verb")
+	assert.NotEmpty(t, results[1].Error, "Failing op should report the unknown verb")
+	_, _, err = store.Get(context.Background(), "bye")
+	assert.NotNil(t, err, "'bye' should not have been created: the whole transaction was aborted")
+}
+
+func TestTransactionLocksAcrossShards(t *testing.T) {
+	store := NewKVStore(3, TestDirectory)
+	results, err := store.Transaction([]TxnOp{
+		{Verb: "set", Key: "notthekindofthingyouwouldfind", Value: 1}, // 0-th shard
+		{Verb: "set", Key: "thisisaverylongkey", Value: 2},            // 1st shard
+		{Verb: "set", Key: "this is an interesting key", Value: 3},    // 2nd shard
+	})
+	assert.Nil(t, err, "Error should be nil when every op succeeds across different shards")
+	assert.Len(t, results, 3)
+	val, _, err := store.Get(context.Background(), "this is an interesting key")
+	assert.Nil(t, err, "Error should be nil when retrieving a key from a different shard")
+	assert.Equal(t, val, 3)
+}
+
+func uint64Ptr(v uint64) *uint64 {
+	return &v
+}
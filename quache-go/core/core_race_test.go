@@ -1,6 +1,7 @@
 package core
 
 import (
+	"context"
 	"fmt"
 	"sync"
 	"testing"
@@ -17,7 +18,7 @@ func TestKVStoreRaceConditionPutGetSingleShard(t *testing.T) {
 			defer wg.Done()
 			for j := range 100 {
 				key := fmt.Sprintf("key-%d-%d", id, j)
-				kvStore.Put(key, "value", nil)
+				kvStore.Put(context.Background(), key, "value", nil)
 			}
 		}(i)
 	}
@@ -28,7 +29,7 @@ func TestKVStoreRaceConditionPutGetSingleShard(t *testing.T) {
 			defer wg.Done()
 			for j := range 100 {
 				key := fmt.Sprintf("key-%d-%d", id%5, j)
-				kvStore.Get(key)
+				kvStore.Get(context.Background(), key)
 			}
 		}(i)
 	}
@@ -47,7 +48,7 @@ func TestKVStoreRaceConditionPutGetMultipleShards(t *testing.T) {
 			defer wg.Done()
 			for j := range 100 {
 				key := fmt.Sprintf("key-%d-%d", id, j)
-				kvStore.Put(key, "value", nil)
+				kvStore.Put(context.Background(), key, "value", nil)
 			}
 		}(i)
 	}
@@ -58,7 +59,7 @@ func TestKVStoreRaceConditionPutGetMultipleShards(t *testing.T) {
 			defer wg.Done()
 			for j := range 100 {
 				key := fmt.Sprintf("key-%d-%d", id%5, j)
-				kvStore.Get(key)
+				kvStore.Get(context.Background(), key)
 			}
 		}(i)
 	}
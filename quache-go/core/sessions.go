@@ -0,0 +1,263 @@
+package core
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"hash/crc32"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/AstraBert/quache/quache-go/metrics"
+)
+
+// Session is a TTL-bound lease that a client renews with RenewSession to
+// keep alive. Sessions back the key-level locks granted by KVStore.Acquire:
+// once a session expires or is destroyed, every lock it held is released.
+type Session struct {
+	ID        string  `json:"id"`
+	Ttl       float64 `json:"ttl"`
+	Timestamp int64   `json:"-"`
+}
+
+type sessionShard struct {
+	mu       sync.RWMutex
+	sessions map[string]*Session
+}
+
+func newSessionShard() *sessionShard {
+	return &sessionShard{sessions: make(map[string]*Session)}
+}
+
+// SessionStore is a sharded registry of live sessions, sharded the same way
+// KVStore shards keys so that session churn under load does not serialize
+// on a single lock.
+type SessionStore struct {
+	shards []*sessionShard
+}
+
+func NewSessionStore(numShards int) *SessionStore {
+	s := &SessionStore{shards: make([]*sessionShard, 0, numShards)}
+	for range numShards {
+		s.shards = append(s.shards, newSessionShard())
+	}
+	return s
+}
+
+func (s *SessionStore) findShard(id string) int {
+	hash := crc32.ChecksumIEEE([]byte(id))
+	return int(hash) % len(s.shards)
+}
+
+func newSessionID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
+
+func isSessionExpired(session *Session, currentTime int64) bool {
+	return session.Ttl > 0 && float64(currentTime-session.Timestamp) > session.Ttl
+}
+
+// Create starts a new session with the given TTL (in seconds; nil means the
+// session never expires on its own and must be explicitly destroyed).
+func (s *SessionStore) Create(ttl *float64) *Session {
+	session := &Session{ID: newSessionID(), Ttl: actualTtlFrom(ttl), Timestamp: time.Now().UnixMilli()}
+	shardIdx := s.findShard(session.ID)
+	shard := s.shards[shardIdx]
+	shard.mu.Lock()
+	shard.sessions[session.ID] = session
+	shard.mu.Unlock()
+	return session
+}
+
+// Renew resets a session's TTL clock, extending its lease. It fails if the
+// session does not exist or has already expired.
+func (s *SessionStore) Renew(id string) (*Session, error) {
+	shardIdx := s.findShard(id)
+	shard := s.shards[shardIdx]
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	session, ok := shard.sessions[id]
+	if !ok || isSessionExpired(session, time.Now().UnixMilli()) {
+		delete(shard.sessions, id)
+		return nil, NewSessionNotFoundError(id)
+	}
+	session.Timestamp = time.Now().UnixMilli()
+	return session, nil
+}
+
+// IsLive reports whether id names a session that exists and has not expired.
+func (s *SessionStore) IsLive(id string) bool {
+	shardIdx := s.findShard(id)
+	shard := s.shards[shardIdx]
+	shard.mu.RLock()
+	defer shard.mu.RUnlock()
+	session, ok := shard.sessions[id]
+	return ok && !isSessionExpired(session, time.Now().UnixMilli())
+}
+
+// Destroy removes a session immediately, regardless of its TTL.
+func (s *SessionStore) Destroy(id string) {
+	shardIdx := s.findShard(id)
+	shard := s.shards[shardIdx]
+	shard.mu.Lock()
+	delete(shard.sessions, id)
+	shard.mu.Unlock()
+}
+
+// Reap removes every expired session and returns the IDs it removed, so the
+// caller can release any locks they were holding.
+func (s *SessionStore) Reap() []string {
+	currentTime := time.Now().UnixMilli()
+	var expired []string
+	for _, shard := range s.shards {
+		shard.mu.Lock()
+		for id, session := range shard.sessions {
+			if isSessionExpired(session, currentTime) {
+				delete(shard.sessions, id)
+				expired = append(expired, id)
+			}
+		}
+		shard.mu.Unlock()
+	}
+	return expired
+}
+
+type SessionNotFoundError struct {
+	id string
+}
+
+func (e SessionNotFoundError) Error() string {
+	return fmt.Sprintf("Session %s not found", e.id)
+}
+
+func NewSessionNotFoundError(id string) SessionNotFoundError {
+	return SessionNotFoundError{id: id}
+}
+
+type LockHeldError struct {
+	key string
+}
+
+func (e LockHeldError) Error() string {
+	return fmt.Sprintf("Key %s is locked by another session", e.key)
+}
+
+func NewLockHeldError(key string) LockHeldError {
+	return LockHeldError{key: key}
+}
+
+type LockNotHeldError struct {
+	key     string
+	session string
+}
+
+func (e LockNotHeldError) Error() string {
+	return fmt.Sprintf("Key %s is not locked by session %s", e.key, e.session)
+}
+
+func NewLockNotHeldError(key string, session string) LockNotHeldError {
+	return LockNotHeldError{key: key, session: session}
+}
+
+// CreateSession starts a new session backing future Acquire calls.
+func (kv *KVStore) CreateSession(ttl *float64) *Session {
+	return kv.sessions.Create(ttl)
+}
+
+// RenewSession extends a session's lease so it does not expire and release
+// its locks.
+func (kv *KVStore) RenewSession(id string) (*Session, error) {
+	return kv.sessions.Renew(id)
+}
+
+// DestroySession ends a session immediately and releases every lock it held.
+func (kv *KVStore) DestroySession(id string) {
+	kv.sessions.Destroy(id)
+	kv.releaseSessionLocks(id)
+}
+
+// ReapSessions removes every expired session, releases the locks each one
+// held, and returns the IDs that were reaped.
+func (kv *KVStore) ReapSessions() []string {
+	expired := kv.sessions.Reap()
+	for _, id := range expired {
+		kv.releaseSessionLocks(id)
+	}
+	return expired
+}
+
+// releaseSessionLocks fans out across every shard and clears the lock on any
+// entry still held by session, e.g. after that session expired or was
+// destroyed.
+func (kv *KVStore) releaseSessionLocks(session string) {
+	for _, shard := range kv.Shards {
+		shard.mu.Lock()
+		for _, entry := range shard.Data {
+			if entry.Session == session {
+				entry.Session = ""
+				entry.LockIndex++
+			}
+		}
+		shard.mu.Unlock()
+	}
+}
+
+// Acquire attempts to grant a session-based lock on key, mirroring Consul's
+// PUT ?acquire=<session>: if key is unlocked (absent, expired, or its holder
+// session is no longer live) the lock is granted to session and value/ttl
+// are written; if it is already held by a different live session the
+// acquisition is rejected. It returns the new LockIndex and whether the
+// lock was acquired.
+func (kv *KVStore) Acquire(key string, value any, ttl *float64, session string) (uint64, bool, error) {
+	if !kv.sessions.IsLive(session) {
+		return 0, false, NewSessionNotFoundError(session)
+	}
+	currentTime := time.Now().UnixMilli()
+	shardIdx := kv.findShard(key)
+	kv.Shards[shardIdx].mu.Lock()
+	defer kv.Shards[shardIdx].mu.Unlock()
+	existing, ok := kv.Shards[shardIdx].Data[key]
+	live := ok && !isExpired(existing, currentTime)
+	if live && existing.Session != "" && existing.Session != session && kv.sessions.IsLive(existing.Session) {
+		return existing.LockIndex, false, NewLockHeldError(key)
+	}
+	var nextIndex uint64 = 1
+	var nextLockIndex uint64 = 1
+	if live {
+		nextIndex = existing.ModifyIndex + 1
+		nextLockIndex = existing.LockIndex + 1
+	}
+	entry := NewShardEntry(value, actualTtlFrom(ttl), nextIndex)
+	entry.Session = session
+	entry.LockIndex = nextLockIndex
+	if kv.wal != nil {
+		if err := kv.wal.Append(shardIdx, walEntry{Op: walOpPut, Key: key, Value: value, Timestamp: entry.Timestamp, Ttl: entry.Ttl, ModifyIndex: entry.ModifyIndex}); err != nil {
+			return 0, false, err
+		}
+	}
+	kv.Shards[shardIdx].Data[key] = entry
+	metrics.ShardEntries.WithLabelValues(strconv.Itoa(shardIdx)).Set(float64(len(kv.Shards[shardIdx].Data)))
+	return entry.LockIndex, true, nil
+}
+
+// Release clears a session-based lock on key if it is currently held by
+// session, mirroring Consul's PUT ?release=<session>. The key's value and
+// ModifyIndex are left untouched; only the lock is cleared.
+func (kv *KVStore) Release(key string, session string) (bool, error) {
+	currentTime := time.Now().UnixMilli()
+	shardIdx := kv.findShard(key)
+	kv.Shards[shardIdx].mu.Lock()
+	defer kv.Shards[shardIdx].mu.Unlock()
+	existing, ok := kv.Shards[shardIdx].Data[key]
+	if !ok || isExpired(existing, currentTime) || existing.Session != session {
+		return false, NewLockNotHeldError(key, session)
+	}
+	existing.Session = ""
+	existing.LockIndex++
+	return true, nil
+}
@@ -0,0 +1,94 @@
+package core
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateAndRenewSession(t *testing.T) {
+	store := NewKVStore(3, TestDirectory)
+	session := store.CreateSession(nil)
+	assert.NotEmpty(t, session.ID, "Session should be assigned a non-empty ID")
+	renewed, err := store.RenewSession(session.ID)
+	assert.Nil(t, err, "Error should be nil when renewing a live session")
+	assert.Equal(t, renewed.ID, session.ID)
+}
+
+func TestRenewSessionNotFound(t *testing.T) {
+	store := NewKVStore(3, TestDirectory)
+	_, err := store.RenewSession("nonexisting")
+	assert.NotNil(t, err, "Error should be non-nil when renewing a session that does not exist")
+	assert.Contains(t, err.Error(), "not found")
+}
+
+func TestAcquireGrantsLockWhenUnlocked(t *testing.T) {
+	store := NewKVStore(3, TestDirectory)
+	session := store.CreateSession(nil)
+	lockIndex, ok, err := store.Acquire("hello", 1, nil, session.ID)
+	assert.Nil(t, err, "Error should be nil when acquiring a lock on an unlocked key")
+	assert.True(t, ok, "Lock should be acquired when the key is unlocked")
+	assert.Equal(t, lockIndex, uint64(1), "First acquisition should produce lock index 1")
+	val, _, err := store.Get(context.Background(), "hello")
+	assert.Nil(t, err, "Error should be nil when retrieving the locked key")
+	assert.Equal(t, val, 1)
+}
+
+func TestAcquireRejectsWhenHeldByAnotherSession(t *testing.T) {
+	store := NewKVStore(3, TestDirectory)
+	session1 := store.CreateSession(nil)
+	session2 := store.CreateSession(nil)
+	_, ok, err := store.Acquire("hello", 1, nil, session1.ID)
+	assert.Nil(t, err, "Error should be nil when acquiring a lock on an unlocked key")
+	assert.True(t, ok)
+	_, ok, err = store.Acquire("hello", 2, nil, session2.ID)
+	assert.False(t, ok, "Lock should be rejected when already held by another session")
+	assert.NotNil(t, err, "Error should be non-nil when the lock is held by another session")
+}
+
+func TestAcquireRejectsUnknownSession(t *testing.T) {
+	store := NewKVStore(3, TestDirectory)
+	_, ok, err := store.Acquire("hello", 1, nil, "nonexisting")
+	assert.False(t, ok, "Lock should be rejected when the session does not exist")
+	assert.NotNil(t, err, "Error should be non-nil when the session does not exist")
+}
+
+func TestReleaseClearsLock(t *testing.T) {
+	store := NewKVStore(3, TestDirectory)
+	session := store.CreateSession(nil)
+	_, ok, err := store.Acquire("hello", 1, nil, session.ID)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	ok, err = store.Release("hello", session.ID)
+	assert.Nil(t, err, "Error should be nil when releasing a lock held by this session")
+	assert.True(t, ok, "Release should succeed when the lock is held by this session")
+	_, ok, err = store.Acquire("hello", 2, nil, session.ID)
+	assert.Nil(t, err, "Error should be nil when re-acquiring a released lock")
+	assert.True(t, ok, "Lock should be re-acquirable once released")
+}
+
+func TestReleaseRejectsWhenNotHeldBySession(t *testing.T) {
+	store := NewKVStore(3, TestDirectory)
+	session1 := store.CreateSession(nil)
+	session2 := store.CreateSession(nil)
+	_, ok, err := store.Acquire("hello", 1, nil, session1.ID)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	ok, err = store.Release("hello", session2.ID)
+	assert.False(t, ok, "Release should be rejected when the lock is held by a different session")
+	assert.NotNil(t, err, "Error should be non-nil when the lock is held by a different session")
+}
+
+func TestDestroySessionReleasesLocks(t *testing.T) {
+	store := NewKVStore(3, TestDirectory)
+	session := store.CreateSession(nil)
+	_, ok, err := store.Acquire("hello", 1, nil, session.ID)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	store.DestroySession(session.ID)
+	otherSession := store.CreateSession(nil)
+	_, ok, err = store.Acquire("hello", 2, nil, otherSession.ID)
+	assert.Nil(t, err, "Error should be nil: the key's lock should have been released when its session was destroyed")
+	assert.True(t, ok, "Lock should be acquirable once its owning session was destroyed")
+}
@@ -0,0 +1,172 @@
+package core
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"sync"
+	"time"
+)
+
+// WALFsyncPolicy controls how often a WAL's appends are flushed to stable
+// storage: "always" fsyncs after every append (safest, slowest), "interval"
+// batches fsyncs on a timer (DefaultWALSyncInterval), and "off" relies on
+// the OS page cache alone (fastest, least durable).
+type WALFsyncPolicy string
+
+const (
+	WALFsyncAlways   WALFsyncPolicy = "always"
+	WALFsyncInterval WALFsyncPolicy = "interval"
+	WALFsyncOff      WALFsyncPolicy = "off"
+)
+
+// DefaultWALSyncInterval is how often a WAL configured with WALFsyncInterval
+// flushes its open segment files to disk.
+const DefaultWALSyncInterval = 200 * time.Millisecond
+
+// walOp names the mutation a walEntry replays.
+type walOp string
+
+const (
+	walOpPut    walOp = "put"
+	walOpDelete walOp = "delete"
+)
+
+// walEntry is a single line appended to a shard's WAL segment before the
+// corresponding mutation is applied to that shard's in-memory map. It
+// carries the same fields as the resulting ShardEntry, rather than just the
+// Put's raw arguments, so replay reconstructs exactly what was written
+// without having to recompute the next ModifyIndex.
+type walEntry struct {
+	Seq uint64 `json:"seq"`
+	Op  walOp  `json:"op"`
+	Key string `json:"key"`
+	// Value round-trips through encoding/json on every Append/Load, so a
+	// numeric value replayed from the WAL always comes back as float64
+	// regardless of the Go type it was written with. This matches
+	// FileBackend and BoltBackend, which persist Entry the same way, so a
+	// value's type after any restart is always float64 whichever of the
+	// durable backends or the WAL reconstructed it.
+	Value       any     `json:"value,omitempty"`
+	Timestamp   int64   `json:"timestamp,omitempty"`
+	Ttl         float64 `json:"ttl,omitempty"`
+	ModifyIndex uint64  `json:"modify_index,omitempty"`
+}
+
+// WAL is a per-shard append-only write-ahead log: Put and Delete append a
+// walEntry here before applying it in memory, so a crash between two
+// periodic KVStore.ToDisk snapshots loses nothing. ToDisk truncates a
+// shard's segment once that shard's snapshot has been durably persisted,
+// so a segment only ever holds entries newer than the last snapshot -
+// replaying it on top of that snapshot is always correct without having to
+// compare sequence numbers against anything stored in the snapshot itself.
+type WAL struct {
+	directory   string
+	fsyncPolicy WALFsyncPolicy
+	files       []*os.File
+	mu          []sync.Mutex
+	seq         []uint64
+}
+
+// NewWAL opens (creating if necessary) one append-only segment file per
+// shard under directory, as "wal-<id>.log". directory must already exist.
+func NewWAL(directory string, numShards int, fsyncPolicy WALFsyncPolicy) (*WAL, error) {
+	wal := &WAL{
+		directory:   directory,
+		fsyncPolicy: fsyncPolicy,
+		files:       make([]*os.File, numShards),
+		mu:          make([]sync.Mutex, numShards),
+		seq:         make([]uint64, numShards),
+	}
+	for i := range numShards {
+		f, err := os.OpenFile(wal.segmentFile(i), os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("opening WAL segment for shard %d: %w", i, err)
+		}
+		wal.files[i] = f
+	}
+	if fsyncPolicy == WALFsyncInterval {
+		go wal.syncLoop()
+	}
+	return wal, nil
+}
+
+func (w *WAL) segmentFile(id int) string {
+	return path.Join(w.directory, fmt.Sprintf("wal-%d.log", id))
+}
+
+func (w *WAL) syncLoop() {
+	ticker := time.NewTicker(DefaultWALSyncInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		for i, f := range w.files {
+			w.mu[i].Lock()
+			_ = f.Sync()
+			w.mu[i].Unlock()
+		}
+	}
+}
+
+// Append adds entry to shard id's segment, applying the WAL's fsync policy.
+func (w *WAL) Append(id int, entry walEntry) error {
+	w.mu[id].Lock()
+	defer w.mu[id].Unlock()
+	w.seq[id]++
+	entry.Seq = w.seq[id]
+	encoded, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if _, err := w.files[id].Write(append(encoded, '\n')); err != nil {
+		return err
+	}
+	if w.fsyncPolicy == WALFsyncAlways {
+		return w.files[id].Sync()
+	}
+	return nil
+}
+
+// Load reads back every entry currently in shard id's segment, in the
+// order they were appended.
+func (w *WAL) Load(id int) ([]walEntry, error) {
+	w.mu[id].Lock()
+	defer w.mu[id].Unlock()
+	if _, err := w.files[id].Seek(0, 0); err != nil {
+		return nil, err
+	}
+	var entries []walEntry
+	scanner := bufio.NewScanner(w.files[id])
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		var entry walEntry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+		if entry.Seq > w.seq[id] {
+			w.seq[id] = entry.Seq
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// Truncate empties shard id's segment, e.g. once ToDisk has durably
+// persisted a fresh snapshot of that shard and the segment's entries are no
+// longer needed to reconstruct it.
+func (w *WAL) Truncate(id int) error {
+	w.mu[id].Lock()
+	defer w.mu[id].Unlock()
+	if err := w.files[id].Truncate(0); err != nil {
+		return err
+	}
+	w.seq[id] = 0
+	return nil
+}
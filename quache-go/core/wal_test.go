@@ -0,0 +1,152 @@
+package core
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const TestWALDirectory string = ".quache-wal-test/"
+
+func makeTestWALDirectory() error {
+	if _, err := os.Stat(TestWALDirectory); err == nil { // exists
+		return nil
+	}
+	return os.Mkdir(TestWALDirectory, 0775)
+}
+
+func cleanupTestWALDirectory() error {
+	if _, err := os.Stat(TestWALDirectory); err != nil {
+		return nil
+	}
+	return os.RemoveAll(TestWALDirectory)
+}
+
+func TestWALAppendAndLoad(t *testing.T) {
+	err := makeTestWALDirectory()
+	if err != nil {
+		t.Fatalf("An error occurred while creating the test directory: %s", err.Error())
+	}
+	defer func() { _ = cleanupTestWALDirectory() }()
+
+	wal, err := NewWAL(TestWALDirectory, 3, WALFsyncAlways)
+	assert.Nil(t, err, "Error should be nil when opening a WAL")
+
+	err = wal.Append(0, walEntry{Op: walOpPut, Key: "hello", Value: float64(1), ModifyIndex: 1})
+	assert.Nil(t, err, "Error should be nil when appending a put entry")
+	err = wal.Append(0, walEntry{Op: walOpDelete, Key: "bye"})
+	assert.Nil(t, err, "Error should be nil when appending a delete entry")
+
+	entries, err := wal.Load(0)
+	assert.Nil(t, err, "Error should be nil when loading a WAL segment")
+	assert.Len(t, entries, 2, "Both appended entries should be loaded back")
+	assert.Equal(t, entries[0].Key, "hello")
+	assert.Equal(t, entries[1].Op, walOpDelete)
+}
+
+func TestWALLoadMissingSegmentIsEmpty(t *testing.T) {
+	err := makeTestWALDirectory()
+	if err != nil {
+		t.Fatalf("An error occurred while creating the test directory: %s", err.Error())
+	}
+	defer func() { _ = cleanupTestWALDirectory() }()
+
+	wal, err := NewWAL(TestWALDirectory, 1, WALFsyncAlways)
+	assert.Nil(t, err, "Error should be nil when opening a WAL")
+	entries, err := wal.Load(0)
+	assert.Nil(t, err, "Error should be nil when a segment has never been appended to")
+	assert.Len(t, entries, 0, "A never-appended-to segment should load as empty")
+}
+
+func TestWALTruncate(t *testing.T) {
+	err := makeTestWALDirectory()
+	if err != nil {
+		t.Fatalf("An error occurred while creating the test directory: %s", err.Error())
+	}
+	defer func() { _ = cleanupTestWALDirectory() }()
+
+	wal, err := NewWAL(TestWALDirectory, 1, WALFsyncAlways)
+	assert.Nil(t, err, "Error should be nil when opening a WAL")
+	err = wal.Append(0, walEntry{Op: walOpPut, Key: "hello", Value: float64(1), ModifyIndex: 1})
+	assert.Nil(t, err, "Error should be nil when appending an entry")
+	err = wal.Truncate(0)
+	assert.Nil(t, err, "Error should be nil when truncating a segment")
+	entries, err := wal.Load(0)
+	assert.Nil(t, err, "Error should be nil when loading a truncated segment")
+	assert.Len(t, entries, 0, "A truncated segment should load as empty")
+}
+
+func TestKVStoreReplaysWALOnTopOfSnapshot(t *testing.T) {
+	err := makeTestWALDirectory()
+	if err != nil {
+		t.Fatalf("An error occurred while creating the test directory: %s", err.Error())
+	}
+	defer func() { _ = cleanupTestWALDirectory() }()
+
+	store := NewKVStore(3, TestWALDirectory)
+	store.SetBackend(NewMemoryBackend())
+	wal, err := NewWAL(TestWALDirectory, 3, WALFsyncAlways)
+	assert.Nil(t, err, "Error should be nil when opening a WAL")
+	store.SetWAL(wal)
+
+	_, err = store.Put(context.Background(), "hello", 1, nil)
+	assert.Nil(t, err, "Error should be nil when putting 'hello'")
+	err = store.ToDisk(context.Background())
+	assert.Nil(t, err, "Error should be nil when flushing to disk")
+
+	_, err = store.Put(context.Background(), "bye", 2, nil)
+	assert.Nil(t, err, "Error should be nil when putting 'bye'")
+
+	replayed, err := NewKVStoreFromBackend(3, TestWALDirectory, store.backend)
+	assert.Nil(t, err, "Error should be nil when loading the last snapshot from the backend")
+	err = replayed.ReplayWAL(wal)
+	assert.Nil(t, err, "Error should be nil when replaying the WAL on top of the loaded snapshot")
+
+	val, _, err := replayed.Get(context.Background(), "hello")
+	assert.Nil(t, err, "'hello' should have been loaded from the snapshot")
+	assert.Equal(t, val, 1)
+	val, _, err = replayed.Get(context.Background(), "bye")
+	assert.Nil(t, err, "'bye' was only in the WAL (never flushed) and should survive the replay")
+	// 'bye' only ever went through the WAL, which (like FileBackend and
+	// BoltBackend) round-trips values through encoding/json, so it comes
+	// back as float64 even though it was put as an int.
+	assert.Equal(t, val, float64(2))
+}
+
+func TestKVStoreReplaysCASAndTransactionWritesFromWAL(t *testing.T) {
+	err := makeTestWALDirectory()
+	if err != nil {
+		t.Fatalf("An error occurred while creating the test directory: %s", err.Error())
+	}
+	defer func() { _ = cleanupTestWALDirectory() }()
+
+	store := NewKVStore(3, TestWALDirectory)
+	store.SetBackend(NewMemoryBackend())
+	wal, err := NewWAL(TestWALDirectory, 3, WALFsyncAlways)
+	assert.Nil(t, err, "Error should be nil when opening a WAL")
+	store.SetWAL(wal)
+
+	_, _, err = store.CompareAndSwap("hello", 1, nil, 0)
+	assert.Nil(t, err, "Error should be nil when creating 'hello' via CAS")
+
+	_, err = store.Transaction([]TxnOp{
+		{Verb: "set", Key: "bye", Value: 2},
+		{Verb: "delete", Key: "hello"},
+	})
+	assert.Nil(t, err, "Error should be nil when every op in the transaction succeeds")
+
+	replayed, err := NewKVStoreFromBackend(3, TestWALDirectory, store.backend)
+	assert.Nil(t, err, "Error should be nil when loading the last snapshot from the backend")
+	err = replayed.ReplayWAL(wal)
+	assert.Nil(t, err, "Error should be nil when replaying the WAL on top of the loaded snapshot")
+
+	val, _, err := replayed.Get(context.Background(), "bye")
+	assert.Nil(t, err, "'bye' was only written via the transaction and should survive the replay")
+	// Like the snapshot test above, anything replayed purely from the WAL
+	// comes back as float64 regardless of the type it was written with.
+	assert.Equal(t, val, float64(2))
+	_, _, err = replayed.Get(context.Background(), "hello")
+	assert.NotNil(t, err, "'hello' was created via CAS then deleted via the transaction; neither should be lost on replay")
+}
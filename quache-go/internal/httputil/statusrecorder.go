@@ -0,0 +1,24 @@
+// Package httputil holds small HTTP helpers shared across quache-go's
+// middleware packages.
+package httputil
+
+import "net/http"
+
+// StatusRecorder wraps an http.ResponseWriter to capture the status code
+// passed to WriteHeader, so middleware can observe it once the handler
+// chain returns.
+type StatusRecorder struct {
+	http.ResponseWriter
+	Status int
+}
+
+// NewStatusRecorder wraps w, defaulting Status to http.StatusOK to match
+// what net/http assumes when a handler never calls WriteHeader explicitly.
+func NewStatusRecorder(w http.ResponseWriter) *StatusRecorder {
+	return &StatusRecorder{ResponseWriter: w, Status: http.StatusOK}
+}
+
+func (r *StatusRecorder) WriteHeader(status int) {
+	r.Status = status
+	r.ResponseWriter.WriteHeader(status)
+}
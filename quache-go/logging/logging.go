@@ -0,0 +1,38 @@
+// Package logging provides the structured logger shared by the server,
+// workers, and core packages, built from CLI flags rather than relying on
+// the stdlib package-level log.
+package logging
+
+import (
+	"os"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	DefaultLevel  string = "info"
+	DefaultFormat string = "text"
+)
+
+// New builds a *logrus.Logger from the given level ("debug", "info", "warn",
+// "error", ...) and format ("json" or "text"). An unrecognized level falls
+// back to info, and an unrecognized format falls back to text.
+func New(level string, format string) *logrus.Logger {
+	logger := logrus.New()
+	logger.Out = os.Stderr
+
+	parsedLevel, err := logrus.ParseLevel(level)
+	if err != nil {
+		parsedLevel = logrus.InfoLevel
+	}
+	logger.SetLevel(parsedLevel)
+
+	switch format {
+	case "json":
+		logger.SetFormatter(&logrus.JSONFormatter{})
+	default:
+		logger.SetFormatter(&logrus.TextFormatter{FullTimestamp: true})
+	}
+
+	return logger
+}
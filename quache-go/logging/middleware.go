@@ -0,0 +1,58 @@
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"time"
+
+	"github.com/AstraBert/quache/quache-go/internal/httputil"
+	"github.com/sirupsen/logrus"
+)
+
+type requestIDKey struct{}
+
+// RequestIDHeader is the response header quache stamps with the request ID
+// used to correlate an HTTP request with its log entry.
+const RequestIDHeader string = "X-Request-Id"
+
+// RequestID returns the request ID stored in ctx by Middleware, or an empty
+// string if ctx was not derived from a request that passed through it.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
+
+// Middleware wraps next with a handler that assigns each request a
+// correlation ID, stores it on the request context, and logs one structured
+// entry per request with method/path/status/latency_ms fields once the
+// handler returns.
+func Middleware(logger *logrus.Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := newRequestID()
+		w.Header().Set(RequestIDHeader, requestID)
+		ctx := context.WithValue(r.Context(), requestIDKey{}, requestID)
+		recorder := httputil.NewStatusRecorder(w)
+
+		start := time.Now()
+		next.ServeHTTP(recorder, r.WithContext(ctx))
+		latency := time.Since(start)
+
+		logger.WithFields(logrus.Fields{
+			"request_id": requestID,
+			"method":     r.Method,
+			"path":       r.URL.Path,
+			"status":     recorder.Status,
+			"latency_ms": float64(latency) / float64(time.Millisecond),
+		}).Info("handled request")
+	})
+}
@@ -0,0 +1,67 @@
+// Package metrics exposes the Prometheus collectors shared by the core,
+// server, and workers packages, and the /metrics HTTP handler that serves
+// them.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	// KVOpsTotal counts KV operations, labeled by op (put/get/delete/txn) and
+	// result: "ok" for successful puts, deletes and transactions, and
+	// hit/miss/expired for gets. Operations that fail with an error are not
+	// counted.
+	KVOpsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "quache_kv_ops_total",
+		Help: "Total number of KV store operations, labeled by operation and result.",
+	}, []string{"op", "result"})
+
+	// KVOpDuration observes how long each KV operation took, in seconds.
+	KVOpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "quache_kv_op_duration_seconds",
+		Help: "Latency of KV store operations, labeled by operation.",
+	}, []string{"op"})
+
+	// ShardEntries reports the current number of entries held by a shard.
+	ShardEntries = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "quache_shard_entries",
+		Help: "Current number of entries stored in a shard.",
+	}, []string{"shard"})
+
+	// ShardFlushDuration observes how long flushing a shard to disk took.
+	ShardFlushDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "quache_shard_flush_duration_seconds",
+		Help: "Latency of flushing a shard to disk, labeled by shard.",
+	}, []string{"shard"})
+
+	// FlushErrorsTotal counts failed ToDisk flushes.
+	FlushErrorsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "quache_flush_errors_total",
+		Help: "Total number of errors encountered while flushing shards to disk.",
+	})
+
+	// CleanupEvictionsTotal counts entries removed by the cleanup worker for
+	// having passed their TTL.
+	CleanupEvictionsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "quache_cleanup_evictions_total",
+		Help: "Total number of entries evicted for having passed their TTL.",
+	})
+
+	// HTTPRequestDuration observes HTTP request latency, labeled by method
+	// and response status.
+	HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "quache_http_request_duration_seconds",
+		Help: "Latency of HTTP requests, labeled by method and status.",
+	}, []string{"method", "status"})
+)
+
+// Handler returns the http.Handler that serves the registered collectors in
+// the Prometheus exposition format.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
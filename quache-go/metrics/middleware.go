@@ -0,0 +1,20 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/AstraBert/quache/quache-go/internal/httputil"
+)
+
+// Middleware wraps next with a handler that observes HTTPRequestDuration for
+// every request, labeled by method and response status.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recorder := httputil.NewStatusRecorder(w)
+		start := time.Now()
+		next.ServeHTTP(recorder, r)
+		HTTPRequestDuration.WithLabelValues(r.Method, strconv.Itoa(recorder.Status)).Observe(time.Since(start).Seconds())
+	})
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/AstraBert/quache/quache-go/cluster"
+)
+
+type ClusterJoinRequest struct {
+	NodeID string `json:"node_id"`
+	Addr   string `json:"addr"`
+}
+
+type ClusterLeaveRequest struct {
+	NodeID string `json:"node_id"`
+}
+
+func handleClusterStatus(clusterNode *cluster.Node, w http.ResponseWriter, r *http.Request) {
+	status, err := clusterNode.Status()
+	if err != nil {
+		http.Error(
+			w,
+			err.Error(),
+			http.StatusInternalServerError,
+		)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	j, err := json.Marshal(status)
+	if err != nil {
+		http.Error(
+			w,
+			err.Error(),
+			http.StatusInternalServerError,
+		)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(j)
+}
+
+func handleClusterJoin(clusterNode *cluster.Node, w http.ResponseWriter, r *http.Request) {
+	var req ClusterJoinRequest
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		http.Error(
+			w,
+			fmt.Sprintf("An error occurred while reading your request: %s", err.Error()),
+			http.StatusBadRequest,
+		)
+		return
+	}
+	if err := clusterNode.Join(req.NodeID, req.Addr); err != nil {
+		http.Error(
+			w,
+			fmt.Sprintf("Join rejected: %s", err.Error()),
+			http.StatusConflict,
+		)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func handleClusterLeave(clusterNode *cluster.Node, w http.ResponseWriter, r *http.Request) {
+	var req ClusterLeaveRequest
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		http.Error(
+			w,
+			fmt.Sprintf("An error occurred while reading your request: %s", err.Error()),
+			http.StatusBadRequest,
+		)
+		return
+	}
+	if err := clusterNode.Leave(req.NodeID); err != nil {
+		http.Error(
+			w,
+			fmt.Sprintf("Leave rejected: %s", err.Error()),
+			http.StatusConflict,
+		)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
@@ -1,25 +1,289 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
 
+	"github.com/AstraBert/quache/quache-go/cluster"
 	"github.com/AstraBert/quache/quache-go/core"
+	"github.com/AstraBert/quache/quache-go/logging"
+	"github.com/AstraBert/quache/quache-go/metrics"
+	"github.com/sirupsen/logrus"
 )
 
 type SetRequest struct {
 	Key   string   `json:"key"`
 	Value any      `json:"value"`
 	Ttl   *float64 `json:"ttl"`
+	CAS   *uint64  `json:"cas"`
 }
 
 type GetResponse struct {
-	Value any `json:"value"`
+	Value       any    `json:"value"`
+	ModifyIndex uint64 `json:"modify_index"`
 }
 
-func handlePost(kvStore *core.KVStore, w http.ResponseWriter, r *http.Request) {
+type SessionRequest struct {
+	Ttl *float64 `json:"ttl"`
+}
+
+type SessionResponse struct {
+	ID  string  `json:"id"`
+	Ttl float64 `json:"ttl"`
+}
+
+func handleListPrefix(kvStore *core.KVStore, w http.ResponseWriter, r *http.Request) {
+	prefix := r.URL.Query().Get("prefix")
+	limit := 0
+	if limitParam := r.URL.Query().Get("limit"); limitParam != "" {
+		parsed, err := strconv.Atoi(limitParam)
+		if err != nil {
+			http.Error(
+				w,
+				fmt.Sprintf("Invalid limit query parameter: %s", err.Error()),
+				http.StatusBadRequest,
+			)
+			return
+		}
+		limit = parsed
+	}
+	entries, err := kvStore.ListPrefix(prefix, limit)
+	if err != nil {
+		http.Error(
+			w,
+			err.Error(),
+			http.StatusInternalServerError,
+		)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	j, err := json.Marshal(entries)
+	if err != nil {
+		http.Error(
+			w,
+			err.Error(),
+			http.StatusInternalServerError,
+		)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(j)
+}
+
+func handleDeletePrefix(kvStore *core.KVStore, w http.ResponseWriter, r *http.Request) {
+	prefix := r.URL.Query().Get("prefix")
+	if r.URL.Query().Get("recurse") != "true" {
+		http.Error(
+			w,
+			"Deleting by prefix requires the 'recurse=true' query parameter",
+			http.StatusBadRequest,
+		)
+		return
+	}
+	limit := 0
+	if limitParam := r.URL.Query().Get("limit"); limitParam != "" {
+		parsed, err := strconv.Atoi(limitParam)
+		if err != nil {
+			http.Error(
+				w,
+				fmt.Sprintf("Invalid limit query parameter: %s", err.Error()),
+				http.StatusBadRequest,
+			)
+			return
+		}
+		limit = parsed
+	}
+	_, err := kvStore.DeletePrefix(prefix, limit)
+	if err != nil {
+		http.Error(
+			w,
+			err.Error(),
+			http.StatusInternalServerError,
+		)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func handleCreateSession(kvStore *core.KVStore, w http.ResponseWriter, r *http.Request) {
+	var req SessionRequest
+	if r.ContentLength != 0 {
+		decoder := json.NewDecoder(r.Body)
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&req); err != nil {
+			http.Error(
+				w,
+				fmt.Sprintf("An error occurred while reading your request: %s", err.Error()),
+				http.StatusBadRequest,
+			)
+			return
+		}
+	}
+	session := kvStore.CreateSession(req.Ttl)
+	apiResponse := SessionResponse{ID: session.ID, Ttl: session.Ttl}
+	w.Header().Set("Content-Type", "application/json")
+	j, err := json.Marshal(apiResponse)
+	if err != nil {
+		http.Error(
+			w,
+			err.Error(),
+			http.StatusInternalServerError,
+		)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	w.Write(j)
+}
+
+func handleRenewSession(kvStore *core.KVStore, w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	session, err := kvStore.RenewSession(id)
+	if err != nil {
+		http.Error(
+			w,
+			err.Error(),
+			http.StatusNotFound,
+		)
+		return
+	}
+	apiResponse := SessionResponse{ID: session.ID, Ttl: session.Ttl}
+	w.Header().Set("Content-Type", "application/json")
+	j, err := json.Marshal(apiResponse)
+	if err != nil {
+		http.Error(
+			w,
+			err.Error(),
+			http.StatusInternalServerError,
+		)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(j)
+}
+
+func handleDestroySession(kvStore *core.KVStore, w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	kvStore.DestroySession(id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func handleLock(kvStore *core.KVStore, clusterNode *cluster.Node, w http.ResponseWriter, r *http.Request) {
+	key := r.PathValue("key")
+	if strings.TrimSpace(key) == "" {
+		http.Error(
+			w,
+			"Provided key was empty, please provide a non-empty key",
+			http.StatusBadRequest,
+		)
+		return
+	}
+	if session := r.URL.Query().Get("release"); session != "" {
+		var err error
+		if clusterNode != nil {
+			err = clusterNode.Release(key, session)
+		} else {
+			_, err = kvStore.Release(key, session)
+		}
+		if err != nil {
+			http.Error(
+				w,
+				fmt.Sprintf("Lock release rejected: %s", err.Error()),
+				http.StatusConflict,
+			)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	session := r.URL.Query().Get("acquire")
+	if session == "" {
+		http.Error(
+			w,
+			"PUT /kv/{key} requires an 'acquire' or 'release' query parameter",
+			http.StatusBadRequest,
+		)
+		return
+	}
+	var req SetRequest
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		http.Error(
+			w,
+			fmt.Sprintf("An error occurred while reading your request: %s", err.Error()),
+			http.StatusBadRequest,
+		)
+		return
+	}
+	var err error
+	if clusterNode != nil {
+		_, err = clusterNode.Acquire(key, req.Value, req.Ttl, session)
+	} else {
+		_, _, err = kvStore.Acquire(key, req.Value, req.Ttl, session)
+	}
+	if err != nil {
+		http.Error(
+			w,
+			fmt.Sprintf("Lock acquisition rejected: %s", err.Error()),
+			http.StatusConflict,
+		)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func handleTxn(kvStore *core.KVStore, clusterNode *cluster.Node, w http.ResponseWriter, r *http.Request) {
+	var ops []core.TxnOp
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&ops); err != nil {
+		http.Error(
+			w,
+			fmt.Sprintf("An error occurred while reading your request: %s", err.Error()),
+			http.StatusBadRequest,
+		)
+		return
+	}
+	var results []core.TxnResult
+	var txnErr error
+	if clusterNode != nil {
+		results, txnErr = clusterNode.Transaction(ops)
+	} else {
+		results, txnErr = kvStore.Transaction(ops)
+	}
+	if txnErr != nil && results == nil {
+		http.Error(
+			w,
+			txnErr.Error(),
+			http.StatusConflict,
+		)
+		return
+	}
+	j, err := json.Marshal(results)
+	if err != nil {
+		http.Error(
+			w,
+			err.Error(),
+			http.StatusInternalServerError,
+		)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if txnErr != nil {
+		w.WriteHeader(http.StatusConflict)
+		w.Write(j)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(j)
+}
+
+func handlePost(kvStore *core.KVStore, clusterNode *cluster.Node, w http.ResponseWriter, r *http.Request) {
 	var req SetRequest
 	decoder := json.NewDecoder(r.Body)
 	decoder.DisallowUnknownFields()
@@ -32,7 +296,36 @@ func handlePost(kvStore *core.KVStore, w http.ResponseWriter, r *http.Request) {
 		)
 		return
 	}
-	kvStore.Put(req.Key, req.Value, req.Ttl)
+	if req.CAS != nil {
+		if clusterNode != nil {
+			_, err = clusterNode.CompareAndSwap(req.Key, req.Value, req.Ttl, *req.CAS)
+		} else {
+			_, _, err = kvStore.CompareAndSwap(req.Key, req.Value, req.Ttl, *req.CAS)
+		}
+		if err != nil {
+			http.Error(
+				w,
+				fmt.Sprintf("CAS write rejected: %s", err.Error()),
+				http.StatusConflict,
+			)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		return
+	}
+	if clusterNode != nil {
+		_, err = clusterNode.Put(req.Key, req.Value, req.Ttl)
+	} else {
+		_, err = kvStore.Put(r.Context(), req.Key, req.Value, req.Ttl)
+	}
+	if err != nil {
+		http.Error(
+			w,
+			err.Error(),
+			http.StatusRequestTimeout,
+		)
+		return
+	}
 	w.WriteHeader(http.StatusCreated)
 }
 
@@ -46,16 +339,20 @@ func handleGet(kvStore *core.KVStore, w http.ResponseWriter, r *http.Request) {
 		)
 		return
 	}
-	val, err := kvStore.Get(key)
+	val, modifyIndex, err := kvStore.Get(r.Context(), key)
 	if err != nil {
+		status := http.StatusNotFound
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			status = http.StatusRequestTimeout
+		}
 		http.Error(
 			w,
 			err.Error(),
-			http.StatusNotFound,
+			status,
 		)
 		return
 	}
-	apiResponse := GetResponse{Value: val}
+	apiResponse := GetResponse{Value: val, ModifyIndex: modifyIndex}
 	w.Header().Set("Content-Type", "application/json")
 	j, err := json.Marshal(apiResponse)
 	if err != nil {
@@ -69,7 +366,7 @@ func handleGet(kvStore *core.KVStore, w http.ResponseWriter, r *http.Request) {
 	w.Write(j)
 }
 
-func handleDelete(kvStore *core.KVStore, w http.ResponseWriter, r *http.Request) {
+func handleDelete(kvStore *core.KVStore, clusterNode *cluster.Node, w http.ResponseWriter, r *http.Request) {
 	key := r.PathValue("key")
 	if key == "" {
 		http.Error(
@@ -79,24 +376,114 @@ func handleDelete(kvStore *core.KVStore, w http.ResponseWriter, r *http.Request)
 		)
 		return
 	}
-	kvStore.Delete(key)
+	if casParam := r.URL.Query().Get("cas"); casParam != "" {
+		cas, err := strconv.ParseUint(casParam, 10, 64)
+		if err != nil {
+			http.Error(
+				w,
+				fmt.Sprintf("Invalid cas query parameter: %s", err.Error()),
+				http.StatusBadRequest,
+			)
+			return
+		}
+		if clusterNode != nil {
+			err = clusterNode.CompareAndDelete(key, cas)
+		} else {
+			_, err = kvStore.CompareAndDelete(key, cas)
+		}
+		if err != nil {
+			http.Error(
+				w,
+				fmt.Sprintf("CAS delete rejected: %s", err.Error()),
+				http.StatusConflict,
+			)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	var err error
+	if clusterNode != nil {
+		err = clusterNode.Delete(key)
+	} else {
+		err = kvStore.Delete(r.Context(), key)
+	}
+	if err != nil {
+		http.Error(
+			w,
+			err.Error(),
+			http.StatusRequestTimeout,
+		)
+		return
+	}
 	w.WriteHeader(http.StatusNoContent)
 }
 
-func CreateServerMux(kvStore *core.KVStore) http.Handler {
+// CreateServerMux builds the HTTP handler for a quache node. clusterNode is
+// nil for a standalone (non-replicated) node, in which case every /kv
+// request is served straight off kvStore. When set, every mutating /kv
+// request is instead proposed through clusterNode (rejected with
+// cluster.NotLeaderError if this node is not the Raft leader) and the
+// /cluster/* endpoints are additionally mounted; reads still come from the
+// local kvStore, which may be slightly stale on a follower.
+func CreateServerMux(kvStore *core.KVStore, logger *logrus.Logger, clusterNode *cluster.Node) http.Handler {
 	mux := http.NewServeMux()
 
 	mux.HandleFunc("POST /kv", func(w http.ResponseWriter, r *http.Request) {
-		handlePost(kvStore, w, r)
+		handlePost(kvStore, clusterNode, w, r)
+	})
+
+	mux.HandleFunc("POST /kv/txn", func(w http.ResponseWriter, r *http.Request) {
+		handleTxn(kvStore, clusterNode, w, r)
 	})
 
 	mux.HandleFunc("GET /kv/{key}", func(w http.ResponseWriter, r *http.Request) {
 		handleGet(kvStore, w, r)
 	})
 
+	mux.HandleFunc("GET /kv", func(w http.ResponseWriter, r *http.Request) {
+		handleListPrefix(kvStore, w, r)
+	})
+
 	mux.HandleFunc("DELETE /kv/{key}", func(w http.ResponseWriter, r *http.Request) {
-		handleDelete(kvStore, w, r)
+		handleDelete(kvStore, clusterNode, w, r)
+	})
+
+	mux.HandleFunc("DELETE /kv", func(w http.ResponseWriter, r *http.Request) {
+		handleDeletePrefix(kvStore, w, r)
+	})
+
+	mux.HandleFunc("PUT /kv/{key}", func(w http.ResponseWriter, r *http.Request) {
+		handleLock(kvStore, clusterNode, w, r)
 	})
 
-	return mux
+	mux.HandleFunc("POST /session", func(w http.ResponseWriter, r *http.Request) {
+		handleCreateSession(kvStore, w, r)
+	})
+
+	mux.HandleFunc("PUT /session/{id}/renew", func(w http.ResponseWriter, r *http.Request) {
+		handleRenewSession(kvStore, w, r)
+	})
+
+	mux.HandleFunc("DELETE /session/{id}", func(w http.ResponseWriter, r *http.Request) {
+		handleDestroySession(kvStore, w, r)
+	})
+
+	mux.Handle("GET /metrics", metrics.Handler())
+
+	if clusterNode != nil {
+		mux.HandleFunc("GET /cluster/status", func(w http.ResponseWriter, r *http.Request) {
+			handleClusterStatus(clusterNode, w, r)
+		})
+
+		mux.HandleFunc("POST /cluster/join", func(w http.ResponseWriter, r *http.Request) {
+			handleClusterJoin(clusterNode, w, r)
+		})
+
+		mux.HandleFunc("POST /cluster/leave", func(w http.ResponseWriter, r *http.Request) {
+			handleClusterLeave(clusterNode, w, r)
+		})
+	}
+
+	return logging.Middleware(logger, metrics.Middleware(mux))
 }
@@ -2,17 +2,54 @@ package server
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"io"
 	"net/http/httptest"
 	"testing"
+	"time"
 
+	"github.com/AstraBert/quache/quache-go/cluster"
 	"github.com/AstraBert/quache/quache-go/core"
+	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 )
 
+func testLogger() *logrus.Logger {
+	logger := logrus.New()
+	logger.Out = io.Discard
+	return logger
+}
+
+// newTestClusterNode bootstraps a single-node cluster rooted at a fresh temp
+// directory and waits for it to elect itself leader, so handlers routed
+// through it behave the same as against the leader of a real cluster.
+func newTestClusterNode(t *testing.T, kvStore *core.KVStore) *cluster.Node {
+	t.Helper()
+	node, err := cluster.NewNode(cluster.Config{
+		NodeID:    "node-1",
+		BindAddr:  "127.0.0.1:0",
+		DataDir:   t.TempDir(),
+		Bootstrap: true,
+		KVStore:   kvStore,
+	}, testLogger())
+	if err != nil {
+		t.Fatalf("An error occurred while starting the cluster node: %s", err.Error())
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if node.IsLeader() {
+			return node
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("cluster node never became leader")
+	return nil
+}
+
 func TestPostRequesSuccess(t *testing.T) {
 	kvStore := core.NewKVStore(5, ".quache-test/")
-	handler := CreateServerMux(kvStore)
+	handler := CreateServerMux(kvStore, testLogger(), nil)
 	responseRecorder := httptest.NewRecorder()
 	reqBodyJson := SetRequest{Value: 1, Key: "hello", Ttl: nil}
 	reqBody, err := json.Marshal(reqBodyJson)
@@ -26,7 +63,7 @@ func TestPostRequesSuccess(t *testing.T) {
 
 func TestPostRequestBadMethod(t *testing.T) {
 	kvStore := core.NewKVStore(5, ".quache-test/")
-	handler := CreateServerMux(kvStore)
+	handler := CreateServerMux(kvStore, testLogger(), nil)
 	responseRecorder := httptest.NewRecorder()
 	reqBodyJson := SetRequest{Value: 1, Key: "hello", Ttl: nil}
 	reqBody, err := json.Marshal(reqBodyJson)
@@ -40,7 +77,7 @@ func TestPostRequestBadMethod(t *testing.T) {
 
 func TestPostRequestBadRequest(t *testing.T) {
 	kvStore := core.NewKVStore(5, ".quache-test/")
-	handler := CreateServerMux(kvStore)
+	handler := CreateServerMux(kvStore, testLogger(), nil)
 	responseRecorder := httptest.NewRecorder()
 	reqBodyJson := map[string]any{"hello": "key", "1": "value", "none": "ttl"}
 	reqBody, err := json.Marshal(reqBodyJson)
@@ -55,8 +92,8 @@ func TestPostRequestBadRequest(t *testing.T) {
 
 func TestGetRequestSuccess(t *testing.T) {
 	kvStore := core.NewKVStore(5, ".quache-test/")
-	kvStore.Put("hello", 1, nil)
-	handler := CreateServerMux(kvStore)
+	kvStore.Put(context.Background(), "hello", 1, nil)
+	handler := CreateServerMux(kvStore, testLogger(), nil)
 	responseRecorder := httptest.NewRecorder()
 	request := httptest.NewRequest("GET", "/kv/hello", nil)
 	handler.ServeHTTP(responseRecorder, request)
@@ -67,18 +104,33 @@ func TestGetRequestSuccess(t *testing.T) {
 	assert.Equal(t, responseBody.Value, float64(1), "Value should be equal to 1")
 }
 
-func TestGetRequestBadMethod(t *testing.T) {
+func TestGetRequestNoPrefixListsEverything(t *testing.T) {
 	kvStore := core.NewKVStore(5, ".quache-test/")
-	handler := CreateServerMux(kvStore)
+	kvStore.Put(context.Background(), "user:1", 1, nil)
+	kvStore.Put(context.Background(), "order:1", 2, nil)
+	handler := CreateServerMux(kvStore, testLogger(), nil)
 	responseRecorder := httptest.NewRecorder()
 	request := httptest.NewRequest("GET", "/kv", nil)
 	handler.ServeHTTP(responseRecorder, request)
-	assert.Equal(t, responseRecorder.Code, 405, "Response code should be 405 (method not allowed)")
+	assert.Equal(t, responseRecorder.Code, 200, "A bare GET /kv should list every key (an empty prefix matches everything)")
+	var entries []core.Entry
+	err := json.Unmarshal(responseRecorder.Body.Bytes(), &entries)
+	assert.Nil(t, err, "there should not be any error when unmarshaling the response body")
+	assert.Len(t, entries, 2, "Both keys should be returned when no prefix is given")
+}
+
+func TestGetRequestBadMethod(t *testing.T) {
+	kvStore := core.NewKVStore(5, ".quache-test/")
+	handler := CreateServerMux(kvStore, testLogger(), nil)
+	responseRecorder := httptest.NewRecorder()
+	request := httptest.NewRequest("PATCH", "/kv/hello", nil)
+	handler.ServeHTTP(responseRecorder, request)
+	assert.Equal(t, responseRecorder.Code, 405, "Response code should be 405 (method not allowed) for a method /kv/{key} doesn't support")
 }
 
 func TestGetRequestNotFound(t *testing.T) {
 	kvStore := core.NewKVStore(5, ".quache-test/")
-	handler := CreateServerMux(kvStore)
+	handler := CreateServerMux(kvStore, testLogger(), nil)
 	responseRecorder := httptest.NewRecorder()
 	request := httptest.NewRequest("GET", "/kv/hello", nil)
 	handler.ServeHTTP(responseRecorder, request)
@@ -88,22 +140,347 @@ func TestGetRequestNotFound(t *testing.T) {
 
 func TestDeleteRequestExistingKey(t *testing.T) {
 	kvStore := core.NewKVStore(5, ".quache-test/")
-	kvStore.Put("hello", 1, nil)
-	handler := CreateServerMux(kvStore)
+	kvStore.Put(context.Background(), "hello", 1, nil)
+	handler := CreateServerMux(kvStore, testLogger(), nil)
 	responseRecorder := httptest.NewRecorder()
 	request := httptest.NewRequest("DELETE", "/kv/hello", nil)
 	handler.ServeHTTP(responseRecorder, request)
 	assert.Equal(t, responseRecorder.Code, 204, "Response code should be 204 (no content)")
-	_, err := kvStore.Get("hello")
+	_, _, err := kvStore.Get(context.Background(), "hello")
 	assert.NotNil(t, err)
 	assert.Contains(t, err.Error(), "not found")
 }
 
 func TestDeleteRequestNonExistingKey(t *testing.T) {
 	kvStore := core.NewKVStore(5, ".quache-test/")
-	handler := CreateServerMux(kvStore)
+	handler := CreateServerMux(kvStore, testLogger(), nil)
 	responseRecorder := httptest.NewRecorder()
 	request := httptest.NewRequest("DELETE", "/kv/hello", nil)
 	handler.ServeHTTP(responseRecorder, request)
 	assert.Equal(t, responseRecorder.Code, 204, "Response code should be 204 (no content)")
 }
+
+func TestListPrefixRequestSuccess(t *testing.T) {
+	kvStore := core.NewKVStore(5, ".quache-test/")
+	kvStore.Put(context.Background(), "user:1", 1, nil)
+	kvStore.Put(context.Background(), "user:2", 2, nil)
+	kvStore.Put(context.Background(), "order:1", 3, nil)
+	handler := CreateServerMux(kvStore, testLogger(), nil)
+	responseRecorder := httptest.NewRecorder()
+	request := httptest.NewRequest("GET", "/kv?prefix=user:", nil)
+	handler.ServeHTTP(responseRecorder, request)
+	assert.Equal(t, responseRecorder.Code, 200, "Response code should be 200")
+	var entries []core.Entry
+	err := json.Unmarshal(responseRecorder.Body.Bytes(), &entries)
+	assert.Nil(t, err, "there should not be any error when unmarshaling the response body")
+	assert.Len(t, entries, 2, "Only the two 'user:' keys should be returned")
+}
+
+func TestDeletePrefixRequestRequiresRecurse(t *testing.T) {
+	kvStore := core.NewKVStore(5, ".quache-test/")
+	kvStore.Put(context.Background(), "user:1", 1, nil)
+	handler := CreateServerMux(kvStore, testLogger(), nil)
+	responseRecorder := httptest.NewRecorder()
+	request := httptest.NewRequest("DELETE", "/kv?prefix=user:", nil)
+	handler.ServeHTTP(responseRecorder, request)
+	assert.Equal(t, responseRecorder.Code, 400, "Response code should be 400 without recurse=true")
+}
+
+func TestDeletePrefixRequestSuccess(t *testing.T) {
+	kvStore := core.NewKVStore(5, ".quache-test/")
+	kvStore.Put(context.Background(), "user:1", 1, nil)
+	kvStore.Put(context.Background(), "user:2", 2, nil)
+	handler := CreateServerMux(kvStore, testLogger(), nil)
+	responseRecorder := httptest.NewRecorder()
+	request := httptest.NewRequest("DELETE", "/kv?prefix=user:&recurse=true", nil)
+	handler.ServeHTTP(responseRecorder, request)
+	assert.Equal(t, responseRecorder.Code, 204, "Response code should be 204 (no content)")
+	_, _, err := kvStore.Get(context.Background(), "user:1")
+	assert.NotNil(t, err, "'user:1' should have been deleted")
+}
+
+func TestPostRequestCASCreatesWhenAbsent(t *testing.T) {
+	kvStore := core.NewKVStore(5, ".quache-test/")
+	handler := CreateServerMux(kvStore, testLogger(), nil)
+	responseRecorder := httptest.NewRecorder()
+	var cas uint64 = 0
+	reqBodyJson := SetRequest{Value: 1, Key: "hello", Ttl: nil, CAS: &cas}
+	reqBody, err := json.Marshal(reqBodyJson)
+	if err != nil {
+		t.Fatalf("An error occurred while marshaling: %s", err.Error())
+	}
+	request := httptest.NewRequest("POST", "/kv", bytes.NewReader(reqBody))
+	handler.ServeHTTP(responseRecorder, request)
+	assert.Equal(t, responseRecorder.Code, 201, "Response code should be 201")
+}
+
+func TestPostRequestCASConflict(t *testing.T) {
+	kvStore := core.NewKVStore(5, ".quache-test/")
+	kvStore.Put(context.Background(), "hello", 1, nil)
+	handler := CreateServerMux(kvStore, testLogger(), nil)
+	responseRecorder := httptest.NewRecorder()
+	var cas uint64 = 0
+	reqBodyJson := SetRequest{Value: 2, Key: "hello", Ttl: nil, CAS: &cas}
+	reqBody, err := json.Marshal(reqBodyJson)
+	if err != nil {
+		t.Fatalf("An error occurred while marshaling: %s", err.Error())
+	}
+	request := httptest.NewRequest("POST", "/kv", bytes.NewReader(reqBody))
+	handler.ServeHTTP(responseRecorder, request)
+	assert.Equal(t, responseRecorder.Code, 409, "Response code should be 409 (conflict)")
+}
+
+func TestDeleteRequestCASConflict(t *testing.T) {
+	kvStore := core.NewKVStore(5, ".quache-test/")
+	kvStore.Put(context.Background(), "hello", 1, nil)
+	handler := CreateServerMux(kvStore, testLogger(), nil)
+	responseRecorder := httptest.NewRecorder()
+	request := httptest.NewRequest("DELETE", "/kv/hello?cas=999", nil)
+	handler.ServeHTTP(responseRecorder, request)
+	assert.Equal(t, responseRecorder.Code, 409, "Response code should be 409 (conflict)")
+	_, _, err := kvStore.Get(context.Background(), "hello")
+	assert.Nil(t, err, "'hello' should not have been deleted")
+}
+
+func TestTxnRequestSuccess(t *testing.T) {
+	kvStore := core.NewKVStore(5, ".quache-test/")
+	kvStore.Put(context.Background(), "hello", 1, nil)
+	handler := CreateServerMux(kvStore, testLogger(), nil)
+	responseRecorder := httptest.NewRecorder()
+	reqBodyJson := []core.TxnOp{
+		{Verb: "set", Key: "bye", Value: 2},
+		{Verb: "delete", Key: "hello"},
+	}
+	reqBody, err := json.Marshal(reqBodyJson)
+	if err != nil {
+		t.Fatalf("An error occurred while marshaling: %s", err.Error())
+	}
+	request := httptest.NewRequest("POST", "/kv/txn", bytes.NewReader(reqBody))
+	handler.ServeHTTP(responseRecorder, request)
+	assert.Equal(t, responseRecorder.Code, 200, "Response code should be 200")
+	var results []core.TxnResult
+	err = json.Unmarshal(responseRecorder.Body.Bytes(), &results)
+	assert.Nil(t, err, "there should not be any error when unmarshaling the response body")
+	assert.Len(t, results, 2)
+	_, _, err = kvStore.Get(context.Background(), "bye")
+	assert.Nil(t, err, "'bye' should have been created by the transaction")
+	_, _, err = kvStore.Get(context.Background(), "hello")
+	assert.NotNil(t, err, "'hello' should have been deleted by the transaction")
+}
+
+func TestSessionCreateRenewDestroy(t *testing.T) {
+	kvStore := core.NewKVStore(5, ".quache-test/")
+	handler := CreateServerMux(kvStore, testLogger(), nil)
+
+	createRecorder := httptest.NewRecorder()
+	createRequest := httptest.NewRequest("POST", "/session", nil)
+	handler.ServeHTTP(createRecorder, createRequest)
+	assert.Equal(t, createRecorder.Code, 201, "Response code should be 201")
+	var session SessionResponse
+	err := json.Unmarshal(createRecorder.Body.Bytes(), &session)
+	assert.Nil(t, err, "there should not be any error when unmarshaling the response body")
+	assert.NotEmpty(t, session.ID, "Session should be assigned a non-empty ID")
+
+	renewRecorder := httptest.NewRecorder()
+	renewRequest := httptest.NewRequest("PUT", "/session/"+session.ID+"/renew", nil)
+	handler.ServeHTTP(renewRecorder, renewRequest)
+	assert.Equal(t, renewRecorder.Code, 200, "Response code should be 200")
+
+	destroyRecorder := httptest.NewRecorder()
+	destroyRequest := httptest.NewRequest("DELETE", "/session/"+session.ID, nil)
+	handler.ServeHTTP(destroyRecorder, destroyRequest)
+	assert.Equal(t, destroyRecorder.Code, 204, "Response code should be 204")
+
+	renewAfterDestroyRecorder := httptest.NewRecorder()
+	handler.ServeHTTP(renewAfterDestroyRecorder, renewRequest)
+	assert.Equal(t, renewAfterDestroyRecorder.Code, 404, "Response code should be 404 once the session has been destroyed")
+}
+
+func TestLockAcquireAndReleaseRequests(t *testing.T) {
+	kvStore := core.NewKVStore(5, ".quache-test/")
+	handler := CreateServerMux(kvStore, testLogger(), nil)
+	session := kvStore.CreateSession(nil)
+
+	reqBody, err := json.Marshal(SetRequest{Value: 1, Key: "hello"})
+	if err != nil {
+		t.Fatalf("An error occurred while marshaling: %s", err.Error())
+	}
+	acquireRecorder := httptest.NewRecorder()
+	acquireRequest := httptest.NewRequest("PUT", "/kv/hello?acquire="+session.ID, bytes.NewReader(reqBody))
+	handler.ServeHTTP(acquireRecorder, acquireRequest)
+	assert.Equal(t, acquireRecorder.Code, 200, "Response code should be 200")
+
+	releaseRecorder := httptest.NewRecorder()
+	releaseRequest := httptest.NewRequest("PUT", "/kv/hello?release="+session.ID, nil)
+	handler.ServeHTTP(releaseRecorder, releaseRequest)
+	assert.Equal(t, releaseRecorder.Code, 200, "Response code should be 200")
+}
+
+func TestLockAcquireConflict(t *testing.T) {
+	kvStore := core.NewKVStore(5, ".quache-test/")
+	handler := CreateServerMux(kvStore, testLogger(), nil)
+	session1 := kvStore.CreateSession(nil)
+	session2 := kvStore.CreateSession(nil)
+
+	reqBody, err := json.Marshal(SetRequest{Value: 1, Key: "hello"})
+	if err != nil {
+		t.Fatalf("An error occurred while marshaling: %s", err.Error())
+	}
+	firstRecorder := httptest.NewRecorder()
+	firstRequest := httptest.NewRequest("PUT", "/kv/hello?acquire="+session1.ID, bytes.NewReader(reqBody))
+	handler.ServeHTTP(firstRecorder, firstRequest)
+	assert.Equal(t, firstRecorder.Code, 200, "Response code should be 200")
+
+	secondRecorder := httptest.NewRecorder()
+	secondRequest := httptest.NewRequest("PUT", "/kv/hello?acquire="+session2.ID, bytes.NewReader(reqBody))
+	handler.ServeHTTP(secondRecorder, secondRequest)
+	assert.Equal(t, secondRecorder.Code, 409, "Response code should be 409 (conflict) when the lock is already held")
+}
+
+func TestTxnRequestCASConflict(t *testing.T) {
+	kvStore := core.NewKVStore(5, ".quache-test/")
+	handler := CreateServerMux(kvStore, testLogger(), nil)
+	responseRecorder := httptest.NewRecorder()
+	var cas uint64 = 999
+	reqBodyJson := []core.TxnOp{
+		{Verb: "set", Key: "bye", Value: 2},
+		{Verb: "cas", Key: "hello", Value: 1, CAS: &cas},
+	}
+	reqBody, err := json.Marshal(reqBodyJson)
+	if err != nil {
+		t.Fatalf("An error occurred while marshaling: %s", err.Error())
+	}
+	request := httptest.NewRequest("POST", "/kv/txn", bytes.NewReader(reqBody))
+	handler.ServeHTTP(responseRecorder, request)
+	assert.Equal(t, responseRecorder.Code, 409, "Response code should be 409 (conflict)")
+	_, _, err = kvStore.Get(context.Background(), "bye")
+	assert.NotNil(t, err, "'bye' should not have been created: the whole transaction was aborted")
+}
+
+func TestPostRequestThroughClusterNode(t *testing.T) {
+	kvStore := core.NewKVStore(5, ".quache-test/")
+	clusterNode := newTestClusterNode(t, kvStore)
+	handler := CreateServerMux(kvStore, testLogger(), clusterNode)
+	responseRecorder := httptest.NewRecorder()
+	reqBodyJson := SetRequest{Value: 1, Key: "hello", Ttl: nil}
+	reqBody, err := json.Marshal(reqBodyJson)
+	if err != nil {
+		t.Fatalf("An error occurred while marshaling: %s", err.Error())
+	}
+	request := httptest.NewRequest("POST", "/kv", bytes.NewReader(reqBody))
+	handler.ServeHTTP(responseRecorder, request)
+	assert.Equal(t, responseRecorder.Code, 201, "Response code should be 201")
+	value, _, err := kvStore.Get(context.Background(), "hello")
+	assert.Nil(t, err, "the write proposed through the cluster node should be applied to the local KVStore")
+	assert.Equal(t, value, float64(1))
+}
+
+func TestDeleteRequestThroughClusterNode(t *testing.T) {
+	kvStore := core.NewKVStore(5, ".quache-test/")
+	clusterNode := newTestClusterNode(t, kvStore)
+	handler := CreateServerMux(kvStore, testLogger(), clusterNode)
+	_, err := clusterNode.Put("hello", 1, nil)
+	if err != nil {
+		t.Fatalf("An error occurred while seeding the key: %s", err.Error())
+	}
+
+	responseRecorder := httptest.NewRecorder()
+	request := httptest.NewRequest("DELETE", "/kv/hello", nil)
+	handler.ServeHTTP(responseRecorder, request)
+	assert.Equal(t, responseRecorder.Code, 204, "Response code should be 204 (no content)")
+	_, _, err = kvStore.Get(context.Background(), "hello")
+	assert.NotNil(t, err, "'hello' should have been deleted through the cluster node")
+}
+
+func TestPostRequestCASThroughClusterNodeConflict(t *testing.T) {
+	kvStore := core.NewKVStore(5, ".quache-test/")
+	clusterNode := newTestClusterNode(t, kvStore)
+	handler := CreateServerMux(kvStore, testLogger(), clusterNode)
+	_, err := clusterNode.Put("hello", 1, nil)
+	if err != nil {
+		t.Fatalf("An error occurred while seeding the key: %s", err.Error())
+	}
+
+	responseRecorder := httptest.NewRecorder()
+	var cas uint64 = 0
+	reqBodyJson := SetRequest{Value: 2, Key: "hello", Ttl: nil, CAS: &cas}
+	reqBody, err := json.Marshal(reqBodyJson)
+	if err != nil {
+		t.Fatalf("An error occurred while marshaling: %s", err.Error())
+	}
+	request := httptest.NewRequest("POST", "/kv", bytes.NewReader(reqBody))
+	handler.ServeHTTP(responseRecorder, request)
+	assert.Equal(t, responseRecorder.Code, 409, "Response code should be 409 (conflict)")
+}
+
+func TestLockAcquireAndReleaseThroughClusterNode(t *testing.T) {
+	kvStore := core.NewKVStore(5, ".quache-test/")
+	clusterNode := newTestClusterNode(t, kvStore)
+	handler := CreateServerMux(kvStore, testLogger(), clusterNode)
+	session := kvStore.CreateSession(nil)
+
+	reqBody, err := json.Marshal(SetRequest{Value: 1, Key: "hello"})
+	if err != nil {
+		t.Fatalf("An error occurred while marshaling: %s", err.Error())
+	}
+	acquireRecorder := httptest.NewRecorder()
+	acquireRequest := httptest.NewRequest("PUT", "/kv/hello?acquire="+session.ID, bytes.NewReader(reqBody))
+	handler.ServeHTTP(acquireRecorder, acquireRequest)
+	assert.Equal(t, acquireRecorder.Code, 200, "Response code should be 200")
+
+	releaseRecorder := httptest.NewRecorder()
+	releaseRequest := httptest.NewRequest("PUT", "/kv/hello?release="+session.ID, nil)
+	handler.ServeHTTP(releaseRecorder, releaseRequest)
+	assert.Equal(t, releaseRecorder.Code, 200, "Response code should be 200")
+}
+
+func TestTxnRequestThroughClusterNode(t *testing.T) {
+	kvStore := core.NewKVStore(5, ".quache-test/")
+	clusterNode := newTestClusterNode(t, kvStore)
+	handler := CreateServerMux(kvStore, testLogger(), clusterNode)
+	_, err := clusterNode.Put("hello", 1, nil)
+	if err != nil {
+		t.Fatalf("An error occurred while seeding the key: %s", err.Error())
+	}
+
+	reqBodyJson := []core.TxnOp{
+		{Verb: "set", Key: "bye", Value: 2},
+		{Verb: "delete", Key: "hello"},
+	}
+	reqBody, err := json.Marshal(reqBodyJson)
+	if err != nil {
+		t.Fatalf("An error occurred while marshaling: %s", err.Error())
+	}
+	responseRecorder := httptest.NewRecorder()
+	request := httptest.NewRequest("POST", "/kv/txn", bytes.NewReader(reqBody))
+	handler.ServeHTTP(responseRecorder, request)
+	assert.Equal(t, responseRecorder.Code, 200, "Response code should be 200")
+	_, _, err = kvStore.Get(context.Background(), "bye")
+	assert.Nil(t, err, "'bye' should have been created through the cluster node")
+}
+
+func TestPostRequestRejectedWhenNotLeader(t *testing.T) {
+	kvStore := core.NewKVStore(5, ".quache-test/")
+	clusterNode, err := cluster.NewNode(cluster.Config{
+		NodeID:    "node-1",
+		BindAddr:  "127.0.0.1:0",
+		DataDir:   t.TempDir(),
+		Bootstrap: false,
+		KVStore:   kvStore,
+	}, testLogger())
+	if err != nil {
+		t.Fatalf("An error occurred while starting the cluster node: %s", err.Error())
+	}
+	handler := CreateServerMux(kvStore, testLogger(), clusterNode)
+
+	responseRecorder := httptest.NewRecorder()
+	reqBodyJson := SetRequest{Value: 1, Key: "hello", Ttl: nil}
+	reqBody, err := json.Marshal(reqBodyJson)
+	if err != nil {
+		t.Fatalf("An error occurred while marshaling: %s", err.Error())
+	}
+	request := httptest.NewRequest("POST", "/kv", bytes.NewReader(reqBody))
+	handler.ServeHTTP(responseRecorder, request)
+	assert.Equal(t, responseRecorder.Code, 408, "Response code should be 408: this node never became leader")
+	assert.Contains(t, responseRecorder.Body.String(), "not the raft leader")
+}
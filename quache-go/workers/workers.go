@@ -2,46 +2,79 @@ package workers
 
 import (
 	"context"
-	"log"
 	"os"
 	"time"
 
 	"github.com/AstraBert/quache/quache-go/core"
+	"github.com/sirupsen/logrus"
 )
 
-func ToDiskWorker(kvStore *core.KVStore, flushingInterval int, done <-chan os.Signal, ctx context.Context) {
+// ToDiskWorker periodically checkpoints kvStore to its backend. When
+// kvStore has a WAL attached, durability no longer depends on this running
+// often - a crash between two checkpoints is recovered from the WAL - so
+// flushingInterval can be set much longer than it would need to be for a
+// WAL-less store.
+func ToDiskWorker(kvStore *core.KVStore, logger *logrus.Logger, flushingInterval int, done <-chan os.Signal, ctx context.Context) {
 	ticker := time.NewTicker(time.Duration(flushingInterval) * time.Millisecond)
 	defer ticker.Stop()
 	for {
 		select {
 		case <-done:
-			log.Println("Stopping disk flushing worker...")
+			logger.Info("Stopping disk flushing worker...")
 			return
 		case <-ctx.Done():
-			log.Println("Stopping disk flushing worker...")
+			logger.Info("Stopping disk flushing worker...")
 			return
 		case <-ticker.C:
-			err := kvStore.ToDisk()
+			start := time.Now()
+			err := kvStore.ToDisk(ctx)
 			if err != nil {
-				log.Printf("\x1b[1;31mERROR\x1b[1;m37%sError while flushing to disk: \n", err.Error())
+				logger.WithError(err).Error("error while flushing to disk")
+				continue
 			}
+			logger.WithField("duration_ms", float64(time.Since(start))/float64(time.Millisecond)).Info("flushed to disk")
 		}
 	}
 }
 
-func CleanupWorker(kvStore *core.KVStore, cleanupInterval int, done <-chan os.Signal, ctx context.Context) {
+func CleanupWorker(kvStore *core.KVStore, logger *logrus.Logger, cleanupInterval int, done <-chan os.Signal, ctx context.Context) {
 	ticker := time.NewTicker(time.Duration(cleanupInterval) * time.Millisecond)
 	defer ticker.Stop()
 	for {
 		select {
 		case <-done:
-			log.Println("Stopping cleanup worker...")
+			logger.Info("Stopping cleanup worker...")
 			return
 		case <-ctx.Done():
-			log.Println("Stopping cleanup worker...")
+			logger.Info("Stopping cleanup worker...")
 			return
 		case <-ticker.C:
-			kvStore.Cleanup()
+			if err := kvStore.Cleanup(ctx); err != nil {
+				logger.WithError(err).Error("error while cleaning up expired entries")
+			}
+		}
+	}
+}
+
+// SessionCleanupWorker periodically reaps expired sessions, releasing the
+// locks each one held, so a client that dies without calling DestroySession
+// does not wedge the keys it had locked forever.
+func SessionCleanupWorker(kvStore *core.KVStore, logger *logrus.Logger, cleanupInterval int, done <-chan os.Signal, ctx context.Context) {
+	ticker := time.NewTicker(time.Duration(cleanupInterval) * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			logger.Info("Stopping session cleanup worker...")
+			return
+		case <-ctx.Done():
+			logger.Info("Stopping session cleanup worker...")
+			return
+		case <-ticker.C:
+			expired := kvStore.ReapSessions()
+			if len(expired) > 0 {
+				logger.WithField("count", len(expired)).Info("reaped expired sessions")
+			}
 		}
 	}
 }
@@ -3,6 +3,7 @@ package workers
 import (
 	"context"
 	"errors"
+	"io"
 	"os"
 	"os/signal"
 	"path"
@@ -11,9 +12,16 @@ import (
 	"time"
 
 	"github.com/AstraBert/quache/quache-go/core"
+	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 )
 
+func testLogger() *logrus.Logger {
+	logger := logrus.New()
+	logger.Out = io.Discard
+	return logger
+}
+
 const TestDirectory string = ".quache-workers/"
 
 func makeTestDirectory() error {
@@ -52,15 +60,15 @@ func TestToDiskWorker(t *testing.T) {
 
 	kvStore := core.NewKVStore(3, TestDirectory)
 	// only .quache-workers/shard-0 and .quache-workers/shard-1 should exist
-	kvStore.Put("notthekindofthingyouwouldfind", 1, nil) // 0-th shard
-	kvStore.Put("thisisaverylongkey", 2, nil)            // 1st shard
+	kvStore.Put(context.Background(), "notthekindofthingyouwouldfind", 1, nil) // 0-th shard
+	kvStore.Put(context.Background(), "thisisaverylongkey", 2, nil)            // 1st shard
 	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*5)
 	defer cancel()
 	done := make(chan os.Signal, 1)
 	signal.Notify(done, os.Interrupt, syscall.SIGINT)
 
 	// flushes every 1 ms
-	ToDiskWorker(kvStore, 1, done, ctx)
+	ToDiskWorker(kvStore, testLogger(), 1, done, ctx)
 
 	assert.True(t, fileExists(path.Join(TestDirectory, "shard-0")))
 	assert.True(t, fileExists(path.Join(TestDirectory, "shard-1")))
@@ -71,20 +79,41 @@ func TestToDiskWorker(t *testing.T) {
 
 func TestCleanupWorker(t *testing.T) {
 	kvStore := core.NewKVStore(3, TestDirectory)
-	var ttl float64 = 0.001                               // 1 millisecond
-	var ttl1 float64 = 1                                  // 1 second
-	kvStore.Put("notthekindofthingyouwouldfind", 1, &ttl) // 0-th shard
-	kvStore.Put("thisisaverylongkey", 2, &ttl1)           // 1st shard
-	kvStore.Put("hey", 3, nil)                            // 2nd shard
+	var ttl float64 = 0.001                                                     // 1 millisecond
+	var ttl1 float64 = 1                                                        // 1 second
+	kvStore.Put(context.Background(), "notthekindofthingyouwouldfind", 1, &ttl) // 0-th shard
+	kvStore.Put(context.Background(), "thisisaverylongkey", 2, &ttl1)           // 1st shard
+	kvStore.Put(context.Background(), "hey", 3, nil)                            // 2nd shard
 	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*5)
 	defer cancel()
 	done := make(chan os.Signal, 1)
 	signal.Notify(done, os.Interrupt, syscall.SIGINT)
 
 	// cleans up every 1 ms
-	CleanupWorker(kvStore, 1, done, ctx)
+	CleanupWorker(kvStore, testLogger(), 1, done, ctx)
 
 	assert.NotContains(t, kvStore.Shards[0].Data, "notthekindofthingyouwouldfind")
 	assert.Contains(t, kvStore.Shards[1].Data, "thisisaverylongkey")
 	assert.Contains(t, kvStore.Shards[2].Data, "hey")
 }
+
+func TestSessionCleanupWorker(t *testing.T) {
+	kvStore := core.NewKVStore(3, TestDirectory)
+	ttl := 0.001 // 1 millisecond
+	session := kvStore.CreateSession(&ttl)
+	_, ok, err := kvStore.Acquire("hello", 1, nil, session.ID)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*5)
+	defer cancel()
+	done := make(chan os.Signal, 1)
+	signal.Notify(done, os.Interrupt, syscall.SIGINT)
+
+	// reaps every 1 ms
+	SessionCleanupWorker(kvStore, testLogger(), 1, done, ctx)
+
+	otherSession := kvStore.CreateSession(nil)
+	_, ok, err = kvStore.Acquire("hello", 2, nil, otherSession.ID)
+	assert.Nil(t, err, "Error should be nil: the expired session's lock should have been released")
+	assert.True(t, ok, "Lock should be acquirable once the owning session expired and was reaped")
+}